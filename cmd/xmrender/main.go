@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/quasilyte/xm"
+	"github.com/quasilyte/xm/wav"
+	"github.com/quasilyte/xm/xmfile"
+)
+
+// This CLI tool renders the specified XM track into a WAV file.
+
+func main() {
+	output := flag.String("o", "", "output WAV file path (defaults to the input path with .wav extension)")
+	sampleRate := flag.Uint("rate", 44100, "output sample rate")
+	interp := flag.String("interp", "linear", "interpolation mode: none, linear-precomputed, linear, cubic, sinc")
+	loops := flag.Int("loops", 0, "how many extra times the song should be repeated")
+	fadeout := flag.Float64("fadeout", 0, "after the last loop, keep playing the song and fade it out during this many seconds")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: xmrender [flags] path/to/music.xm\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if len(flag.Args()) != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	config := renderConfig{
+		input:      flag.Args()[0],
+		output:     *output,
+		sampleRate: *sampleRate,
+		interp:     *interp,
+		loops:      *loops,
+		fadeout:    *fadeout,
+	}
+	if config.output == "" {
+		config.output = strings.TrimSuffix(config.input, filepath.Ext(config.input)) + ".wav"
+	}
+
+	if err := render(config); err != nil {
+		fmt.Fprintf(os.Stderr, "xmrender: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+type renderConfig struct {
+	input      string
+	output     string
+	sampleRate uint
+	interp     string
+	loops      int
+	fadeout    float64
+}
+
+func render(config renderConfig) error {
+	interp, err := parseInterpolation(config.interp)
+	if err != nil {
+		return err
+	}
+	if config.loops < 0 {
+		return errors.New("loops can't be negative")
+	}
+	if config.fadeout < 0 {
+		return errors.New("fadeout can't be negative")
+	}
+
+	data, err := os.ReadFile(config.input)
+	if err != nil {
+		return fmt.Errorf("read XM file: %w", err)
+	}
+	xmParser := xmfile.NewParser(xmfile.ParserConfig{})
+	xmModule, err := xmParser.ParseFromBytes(data)
+	if err != nil {
+		return fmt.Errorf("parse XM file: %w", err)
+	}
+	xmStream := xm.NewStream()
+	err = xmStream.LoadModule(xmModule, xm.LoadModuleConfig{
+		SampleRate:    config.sampleRate,
+		Interpolation: interp,
+	})
+	if err != nil {
+		return fmt.Errorf("compile XM module: %w", err)
+	}
+
+	if config.loops > 0 || config.fadeout > 0 {
+		loopCount := config.loops
+		if config.fadeout > 0 {
+			// The fadeout is played during an extra song iteration.
+			loopCount++
+		}
+		xmStream.SetLooping(true)
+		xmStream.SetLoopCount(loopCount)
+	}
+	if config.fadeout > 0 {
+		// Start the fadeout on the first row of the extra iteration.
+		// The stream ends as soon as the fade is completed.
+		fadePending := false
+		xmStream.SetEventHandler(func(e xm.StreamEvent) {
+			switch e.Kind {
+			case xm.EventLoop:
+				count, song := e.LoopEventData()
+				fadePending = song && count == config.loops+1
+			case xm.EventRow:
+				if fadePending {
+					fadePending = false
+					xmStream.FadeOut(config.fadeout)
+				}
+			}
+		})
+	}
+
+	f, err := os.Create(config.output)
+	if err != nil {
+		return err
+	}
+	if _, err := wav.Write(f, xmStream); err != nil {
+		f.Close()
+		return fmt.Errorf("write WAV file: %w", err)
+	}
+	return f.Close()
+}
+
+func parseInterpolation(s string) (xm.InterpolationMode, error) {
+	switch s {
+	case "none":
+		return xm.InterpolationNone, nil
+	case "linear-precomputed":
+		return xm.InterpolationLinearPrecomputed, nil
+	case "linear":
+		return xm.InterpolationLinear, nil
+	case "cubic":
+		return xm.InterpolationCubic, nil
+	case "sinc":
+		return xm.InterpolationSinc, nil
+	default:
+		return 0, fmt.Errorf("unknown interpolation mode %q", s)
+	}
+}
@@ -0,0 +1,101 @@
+package dsp
+
+import (
+	"math"
+)
+
+// Compressor is a feed-forward dynamic range compressor.
+// It reduces the volume of the loud parts, making the music level more even.
+// Both stereo channels are compressed by the same amount.
+type Compressor struct {
+	config CompressorConfig
+
+	// The envelope follower state (in linear amplitude).
+	envelope float64
+
+	initRate     int
+	attackCoeff  float64
+	releaseCoeff float64
+	threshold    float64
+	makeupGain   float64
+}
+
+// CompressorConfig describes the compressor parameters.
+type CompressorConfig struct {
+	// Threshold is a level (in dBFS) above which the signal is compressed.
+	// A zero value means -12 dB.
+	Threshold float64
+
+	// Ratio is a compression ratio; a ratio of 4 means that
+	// every 4 dB above the threshold become 1 dB.
+	// A zero value means 4. Values below 1 are treated as 1 (no compression).
+	Ratio float64
+
+	// Attack is a time (in seconds) for the compressor to react to a loud signal.
+	// A zero value means 10ms.
+	Attack float64
+
+	// Release is a time (in seconds) for the compressor to recover after a loud signal.
+	// A zero value means 100ms.
+	Release float64
+
+	// MakeupGain is an output gain (in dB) that compensates the volume reduction.
+	MakeupGain float64
+}
+
+// NewCompressor returns a compressor with the specified parameters.
+func NewCompressor(config CompressorConfig) *Compressor {
+	if config.Threshold == 0 {
+		config.Threshold = -12
+	}
+	if config.Ratio == 0 {
+		config.Ratio = 4
+	}
+	config.Ratio = max(config.Ratio, 1)
+	if config.Attack == 0 {
+		config.Attack = 0.01
+	}
+	if config.Release == 0 {
+		config.Release = 0.1
+	}
+	return &Compressor{
+		config:     config,
+		threshold:  dbToAmplitude(config.Threshold),
+		makeupGain: dbToAmplitude(config.MakeupGain),
+	}
+}
+
+func (c *Compressor) init(sampleRate int) {
+	c.initRate = sampleRate
+	c.attackCoeff = math.Exp(-1 / (c.config.Attack * float64(sampleRate)))
+	c.releaseCoeff = math.Exp(-1 / (c.config.Release * float64(sampleRate)))
+}
+
+// Process implements the xm.Processor interface.
+func (c *Compressor) Process(samples []float32, sampleRate int) {
+	if c.initRate != sampleRate {
+		c.init(sampleRate)
+	}
+
+	for i := 0; i+1 < len(samples); i += 2 {
+		level := max(math.Abs(float64(samples[i])), math.Abs(float64(samples[i+1])))
+		coeff := c.releaseCoeff
+		if level > c.envelope {
+			coeff = c.attackCoeff
+		}
+		c.envelope = level + coeff*(c.envelope-level)
+
+		gain := c.makeupGain
+		if c.envelope > c.threshold {
+			// Above the threshold: out = threshold * (in/threshold)^(1/ratio).
+			over := c.envelope / c.threshold
+			gain *= math.Pow(over, 1/c.config.Ratio) / over
+		}
+		samples[i] *= float32(gain)
+		samples[i+1] *= float32(gain)
+	}
+}
+
+func dbToAmplitude(db float64) float64 {
+	return math.Pow(10, db/20)
+}
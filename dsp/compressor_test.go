@@ -0,0 +1,29 @@
+package dsp
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCompressor(t *testing.T) {
+	// The threshold is -12 dB (0.25) and the ratio is 4.
+	c := NewCompressor(CompressorConfig{})
+
+	// A quiet signal is below the threshold, so it's not affected.
+	quiet := sineWave(440, 0.1)
+	want := rms(quiet)
+	c.Process(quiet, testSampleRate)
+	if have := rms(quiet); math.Abs(have-want) > 1e-6 {
+		t.Fatalf("quiet signal level changed:\nhave %f\nwant %f", have, want)
+	}
+
+	// A loud signal peaks 12 dB above the threshold.
+	// Its level should be reduced by ~9 dB (a factor of ~2.8).
+	loud := sineWave(440, 1)
+	in := rms(loud)
+	c.Process(loud, testSampleRate)
+	gain := rms(loud) / in
+	if gain < 0.3 || gain > 0.6 {
+		t.Fatalf("loud signal gain %f is out of [0.3, 0.6] range", gain)
+	}
+}
@@ -0,0 +1,50 @@
+// Package dsp implements some basic post-mix audio processors for the XM streams.
+//
+// All processors implement the xm.Processor interface.
+// Use Stream.SetProcessors to install them.
+//
+// The processors that have some parameters adjustable during the playback
+// (like the filter cutoff frequency) can be safely tweaked from any goroutine.
+package dsp
+
+import (
+	"math"
+	"sync/atomic"
+
+	"github.com/quasilyte/xm"
+)
+
+var (
+	_ xm.Processor = (*LowPass)(nil)
+	_ xm.Processor = (*HighPass)(nil)
+	_ xm.Processor = (*Reverb)(nil)
+	_ xm.Processor = (*Compressor)(nil)
+)
+
+// atomicFloat is a float64 value that can be accessed concurrently.
+type atomicFloat struct {
+	bits atomic.Uint64
+}
+
+func (f *atomicFloat) Load() float64 {
+	return math.Float64frombits(f.bits.Load())
+}
+
+func (f *atomicFloat) Store(v float64) {
+	f.bits.Store(math.Float64bits(v))
+}
+
+func clamp(v, min, max float64) float64 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// onePoleCoeff returns a smoothing coefficient of a one-pole low-pass filter.
+func onePoleCoeff(cutoff float64, sampleRate int) float32 {
+	return float32(1 - math.Exp(-2*math.Pi*cutoff/float64(sampleRate)))
+}
@@ -0,0 +1,81 @@
+package dsp
+
+// LowPass is a one-pole low-pass filter.
+// It attenuates the frequencies above its cutoff frequency.
+//
+// With a low cutoff (a few hundred Hz), it can be used
+// for the "underwater" or "behind the wall" muffling effect.
+type LowPass struct {
+	cutoff atomicFloat
+
+	// The filter state (per channel).
+	prev [2]float32
+}
+
+// NewLowPass returns a low-pass filter with the specified cutoff frequency (in Hz).
+func NewLowPass(cutoff float64) *LowPass {
+	f := &LowPass{}
+	f.SetCutoff(cutoff)
+	return f
+}
+
+// SetCutoff changes the filter cutoff frequency (in Hz).
+// The value is clamped to be at least 1.
+//
+// This method can be called from any goroutine.
+func (f *LowPass) SetCutoff(cutoff float64) {
+	f.cutoff.Store(max(cutoff, 1))
+}
+
+// Process implements the xm.Processor interface.
+func (f *LowPass) Process(samples []float32, sampleRate int) {
+	a := onePoleCoeff(f.cutoff.Load(), sampleRate)
+	left, right := f.prev[0], f.prev[1]
+	for i := 0; i+1 < len(samples); i += 2 {
+		left += a * (samples[i] - left)
+		right += a * (samples[i+1] - right)
+		samples[i] = left
+		samples[i+1] = right
+	}
+	f.prev[0], f.prev[1] = left, right
+}
+
+// HighPass is a one-pole high-pass filter.
+// It attenuates the frequencies below its cutoff frequency.
+//
+// It can be used to make the music sound "thin", like it's
+// played through a small speaker or a radio.
+type HighPass struct {
+	cutoff atomicFloat
+
+	// The low-pass state (per channel); the output is the input minus the low-pass.
+	prev [2]float32
+}
+
+// NewHighPass returns a high-pass filter with the specified cutoff frequency (in Hz).
+func NewHighPass(cutoff float64) *HighPass {
+	f := &HighPass{}
+	f.SetCutoff(cutoff)
+	return f
+}
+
+// SetCutoff changes the filter cutoff frequency (in Hz).
+// The value is clamped to be at least 1.
+//
+// This method can be called from any goroutine.
+func (f *HighPass) SetCutoff(cutoff float64) {
+	f.cutoff.Store(max(cutoff, 1))
+}
+
+// Process implements the xm.Processor interface.
+func (f *HighPass) Process(samples []float32, sampleRate int) {
+	a := onePoleCoeff(f.cutoff.Load(), sampleRate)
+	left, right := f.prev[0], f.prev[1]
+	for i := 0; i+1 < len(samples); i += 2 {
+		left += a * (samples[i] - left)
+		right += a * (samples[i+1] - right)
+		samples[i] -= left
+		samples[i+1] -= right
+	}
+	f.prev[0], f.prev[1] = left, right
+}
@@ -0,0 +1,62 @@
+package dsp
+
+import (
+	"math"
+	"testing"
+)
+
+const testSampleRate = 44100
+
+// sineWave returns one second of an interleaved stereo sine wave.
+func sineWave(freq, amplitude float64) []float32 {
+	samples := make([]float32, testSampleRate*2)
+	for i := 0; i < len(samples); i += 2 {
+		v := float32(amplitude * math.Sin(2*math.Pi*freq*float64(i/2)/testSampleRate))
+		samples[i] = v
+		samples[i+1] = v
+	}
+	return samples
+}
+
+// rms measures the signal level skipping the first 0.1 second,
+// so the filters state has enough time to settle.
+func rms(samples []float32) float64 {
+	samples = samples[testSampleRate/10*2:]
+	sum := 0.0
+	for _, v := range samples {
+		sum += float64(v) * float64(v)
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
+
+func TestFilters(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter interface {
+			Process(samples []float32, sampleRate int)
+		}
+		freq    float64
+		minGain float64
+		maxGain float64
+	}{
+		{"low pass: high freq", NewLowPass(200), 10000, 0, 0.1},
+		{"low pass: low freq", NewLowPass(2000), 50, 0.9, 1},
+		{"high pass: low freq", NewHighPass(2000), 50, 0, 0.1},
+		{"high pass: high freq", NewHighPass(200), 10000, 0.9, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			samples := sineWave(test.freq, 0.5)
+			in := rms(samples)
+			// Process the signal in chunks, like the stream does it.
+			for i := 0; i < len(samples); i += 882 * 2 {
+				test.filter.Process(samples[i:min(i+882*2, len(samples))], testSampleRate)
+			}
+			gain := rms(samples) / in
+			if gain < test.minGain || gain > test.maxGain {
+				t.Fatalf("gain %f is out of [%f, %f] range", gain, test.minGain, test.maxGain)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package dsp
+
+// Reverb is a simple Schroeder-style reverb (a lightweight Freeverb variation).
+// It uses several parallel comb filters followed by the serial all-pass filters.
+type Reverb struct {
+	mix atomicFloat
+
+	feedback float32
+	damping  float32
+
+	// The delay lines are allocated during the first Process call.
+	initRate int
+	channels [2]reverbChannel
+}
+
+// ReverbConfig describes the reverb parameters.
+type ReverbConfig struct {
+	// RoomSize controls the reverb tail length.
+	// The value is clamped in [0, 1].
+	RoomSize float64
+
+	// Damping controls how fast the high frequencies decay.
+	// The value is clamped in [0, 1].
+	Damping float64
+
+	// Mix is the processed (wet) signal level.
+	// A value of 0 disables the reverb, a value of 1 makes the output fully wet.
+	// The value is clamped in [0, 1].
+	Mix float64
+}
+
+type reverbChannel struct {
+	combs     [4]combFilter
+	allPasses [2]allPassFilter
+}
+
+type combFilter struct {
+	buf   []float32
+	pos   int
+	store float32
+}
+
+type allPassFilter struct {
+	buf []float32
+	pos int
+}
+
+// The delay line lengths (in samples at 44100 Hz).
+// The right channel uses slightly longer lines to make the reverb wider.
+var (
+	reverbCombLengths    = [4]int{1116, 1188, 1277, 1356}
+	reverbAllPassLengths = [2]int{556, 441}
+)
+
+const reverbStereoSpread = 23
+
+// NewReverb returns a reverb with the specified parameters.
+func NewReverb(config ReverbConfig) *Reverb {
+	r := &Reverb{
+		// The feedback values in [0.7, 0.98] sound reasonable.
+		feedback: 0.7 + float32(clamp(config.RoomSize, 0, 1))*0.28,
+		damping:  float32(clamp(config.Damping, 0, 1)),
+	}
+	r.SetMix(config.Mix)
+	return r
+}
+
+// SetMix changes the processed (wet) signal level.
+// The value is clamped in [0, 1].
+//
+// This method can be called from any goroutine.
+func (r *Reverb) SetMix(mix float64) {
+	r.mix.Store(clamp(mix, 0, 1))
+}
+
+func (r *Reverb) init(sampleRate int) {
+	r.initRate = sampleRate
+	scale := float64(sampleRate) / 44100
+	for c := range r.channels {
+		ch := &r.channels[c]
+		spread := c * reverbStereoSpread
+		for i := range ch.combs {
+			ch.combs[i] = combFilter{buf: make([]float32, int(float64(reverbCombLengths[i]+spread)*scale))}
+		}
+		for i := range ch.allPasses {
+			ch.allPasses[i] = allPassFilter{buf: make([]float32, int(float64(reverbAllPassLengths[i]+spread)*scale))}
+		}
+	}
+}
+
+// Process implements the xm.Processor interface.
+func (r *Reverb) Process(samples []float32, sampleRate int) {
+	if r.initRate != sampleRate {
+		r.init(sampleRate)
+	}
+
+	wet := float32(r.mix.Load())
+	dry := 1 - wet
+	if wet == 0 {
+		return
+	}
+
+	for i := 0; i+1 < len(samples); i += 2 {
+		for c := range r.channels {
+			x := samples[i+c]
+			samples[i+c] = x*dry + r.channels[c].process(x, r.feedback, r.damping)*wet
+		}
+	}
+}
+
+func (ch *reverbChannel) process(x, feedback, damping float32) float32 {
+	// A fixed input gain keeps the sum of combs in a sane range.
+	const inputGain = 0.25 * 0.5
+
+	input := x * inputGain
+	out := float32(0)
+	for i := range ch.combs {
+		out += ch.combs[i].process(input, feedback, damping)
+	}
+	for i := range ch.allPasses {
+		out = ch.allPasses[i].process(out)
+	}
+	return out
+}
+
+func (f *combFilter) process(x, feedback, damping float32) float32 {
+	y := f.buf[f.pos]
+	f.store = y*(1-damping) + f.store*damping
+	f.buf[f.pos] = x + f.store*feedback
+	f.pos++
+	if f.pos == len(f.buf) {
+		f.pos = 0
+	}
+	return y
+}
+
+func (f *allPassFilter) process(x float32) float32 {
+	const feedback = 0.5
+
+	delayed := f.buf[f.pos]
+	y := delayed - x
+	f.buf[f.pos] = x + delayed*feedback
+	f.pos++
+	if f.pos == len(f.buf) {
+		f.pos = 0
+	}
+	return y
+}
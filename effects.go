@@ -0,0 +1,97 @@
+package xm
+
+import (
+	"github.com/quasilyte/xm/internal/xmdb"
+)
+
+// EffectOp is a pattern effect operation.
+// It's reported by the EventEffect, see StreamEvent.EffectEventData.
+//
+// The volume column effects are mapped to the same operations as
+// their effect column counterparts when possible (e.g. EffectSetVolume).
+type EffectOp = xmdb.EffectOp
+
+const (
+	EffectNone EffectOp = xmdb.EffectNone
+
+	// Effect 0xy.
+	EffectArpeggio EffectOp = xmdb.EffectArpeggio
+
+	// Effect 1xx.
+	EffectPortamentoUp EffectOp = xmdb.EffectPortamentoUp
+
+	// Effect 2xx.
+	EffectPortamentoDown EffectOp = xmdb.EffectPortamentoDown
+
+	// Effect 3xx (also known as tone portamento).
+	EffectNotePortamento EffectOp = xmdb.EffectNotePortamento
+
+	// Effect 4xy.
+	EffectVibrato EffectOp = xmdb.EffectVibrato
+
+	// Effect 6xy.
+	EffectVibratoWithVolumeSlide EffectOp = xmdb.EffectVibratoWithVolumeSlide
+
+	// Effect Axy.
+	EffectVolumeSlide EffectOp = xmdb.EffectVolumeSlide
+
+	// Effect Cxx or a volume column value.
+	EffectSetVolume EffectOp = xmdb.EffectSetVolume
+
+	// Effect Dxx.
+	EffectPatternBreak EffectOp = xmdb.EffectPatternBreak
+
+	// Effect E1x.
+	EffectFinePortamentoUp EffectOp = xmdb.EffectFinePortamentoUp
+
+	// Effect E2x.
+	EffectFinePortamentoDown EffectOp = xmdb.EffectFinePortamentoDown
+
+	// Volume column slides.
+	EffectVolumeSlideDown EffectOp = xmdb.EffectVolumeSlideDown
+	EffectVolumeSlideUp   EffectOp = xmdb.EffectVolumeSlideUp
+
+	// Effects EBx and EAx (or their volume column counterparts).
+	EffectFineVolumeSlideDown EffectOp = xmdb.EffectFineVolumeSlideDown
+	EffectFineVolumeSlideUp   EffectOp = xmdb.EffectFineVolumeSlideUp
+
+	// Volume column panning slides.
+	EffectPanningSlideLeft  EffectOp = xmdb.EffectPanningSlideLeft
+	EffectPanningSlideRight EffectOp = xmdb.EffectPanningSlideRight
+
+	// Effect Fxx with xx>0x1F.
+	EffectSetBPM EffectOp = xmdb.EffectSetBPM
+
+	// Effect Fxx with xx<=0x1F.
+	EffectSetTempo EffectOp = xmdb.EffectSetTempo
+
+	// Effect Gxx.
+	EffectSetGlobalVolume EffectOp = xmdb.EffectSetGlobalVolume
+
+	// Effect Hxy.
+	EffectGlobalVolumeSlide EffectOp = xmdb.EffectGlobalVolumeSlide
+
+	// A key-off note (97).
+	EffectEarlyKeyOff EffectOp = xmdb.EffectEarlyKeyOff
+
+	// Effect Kxx.
+	EffectKeyOff EffectOp = xmdb.EffectKeyOff
+
+	// Effect Lxx.
+	EffectSetEnvelopePos EffectOp = xmdb.EffectSetEnvelopePos
+
+	// Effect ECx.
+	EffectNoteCut EffectOp = xmdb.EffectNoteCut
+
+	// Effect Pxy.
+	EffectPanningSlide EffectOp = xmdb.EffectPanningSlide
+
+	// Effect 8xx or a volume column value.
+	EffectSetPanning EffectOp = xmdb.EffectSetPanning
+
+	// Effect 9xx.
+	EffectSampleOffset EffectOp = xmdb.EffectSampleOffset
+
+	// A cue marker, see LoadModuleConfig.MarkerEffect.
+	EffectMarker EffectOp = xmdb.EffectMarker
+)
@@ -0,0 +1,102 @@
+package xm
+
+import (
+	"sync/atomic"
+)
+
+// EventQueue is a fixed-size ring buffer of stream events.
+// Use Stream.SetEventQueue to make the stream fill it.
+//
+// It's a lock-free single-producer single-consumer queue:
+// the stream pushes the events from the goroutine that reads it
+// (e.g. the Ebitengine audio goroutine), while another goroutine
+// (e.g. the game update loop) pops them.
+// Only one goroutine is allowed to consume the events.
+//
+// When the queue is full, the new events are discarded.
+// Use Dropped to check whether it ever happened.
+//
+// Experimental: the events handling API may change significantly in the future.
+type EventQueue struct {
+	buf  []StreamEvent
+	mask uint64
+
+	// head is only written by the consumer.
+	// tail is only written by the producer.
+	head atomic.Uint64
+	tail atomic.Uint64
+
+	dropped atomic.Uint64
+}
+
+// NewEventQueue allocates an event queue that can hold up to capacity events.
+// The capacity is rounded up to the power of two.
+// A capacity of 0 (or less) means 1024.
+func NewEventQueue(capacity int) *EventQueue {
+	if capacity <= 0 {
+		capacity = 1024
+	}
+	size := 1
+	for size < capacity {
+		size *= 2
+	}
+	return &EventQueue{
+		buf:  make([]StreamEvent, size),
+		mask: uint64(size - 1),
+	}
+}
+
+// Cap returns the queue capacity.
+func (q *EventQueue) Cap() int {
+	return len(q.buf)
+}
+
+// Len returns the number of events that can be popped right now.
+func (q *EventQueue) Len() int {
+	return int(q.tail.Load() - q.head.Load())
+}
+
+// Dropped returns the number of events that were discarded
+// due to the queue being full.
+// If this number grows, the queue should be drained more often
+// or its capacity should be increased.
+func (q *EventQueue) Dropped() uint64 {
+	return q.dropped.Load()
+}
+
+// Pop removes the oldest event from the queue.
+// If the queue is empty, it returns false.
+func (q *EventQueue) Pop() (StreamEvent, bool) {
+	head := q.head.Load()
+	if head == q.tail.Load() {
+		return StreamEvent{}, false
+	}
+	e := q.buf[head&q.mask]
+	q.head.Store(head + 1)
+	return e, true
+}
+
+// Drain appends all queued events to dst and returns the extended slice.
+// The events are removed from the queue.
+//
+// It's intended to be called once per game frame.
+// Re-use the dst slice between the calls to avoid allocations.
+func (q *EventQueue) Drain(dst []StreamEvent) []StreamEvent {
+	head := q.head.Load()
+	tail := q.tail.Load()
+	for i := head; i != tail; i++ {
+		dst = append(dst, q.buf[i&q.mask])
+	}
+	q.head.Store(tail)
+	return dst
+}
+
+func (q *EventQueue) push(e StreamEvent) {
+	tail := q.tail.Load()
+	if tail-q.head.Load() == uint64(len(q.buf)) {
+		q.dropped.Add(1)
+		return
+	}
+	q.buf[tail&q.mask] = e
+	q.tail.Store(tail + 1)
+}
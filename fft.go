@@ -0,0 +1,72 @@
+package xm
+
+import (
+	"math"
+)
+
+// fft is a precomputed radix-2 FFT of a fixed size.
+// It's used for the spectrum analysis; it's not meant to be very fast.
+type fft struct {
+	n        int
+	cos      []float64
+	sin      []float64
+	reversed []int
+}
+
+func newFFT(n int) *fft {
+	f := &fft{
+		n:        n,
+		cos:      make([]float64, n/2),
+		sin:      make([]float64, n/2),
+		reversed: make([]int, n),
+	}
+	for i := range f.cos {
+		angle := -2 * math.Pi * float64(i) / float64(n)
+		f.cos[i] = math.Cos(angle)
+		f.sin[i] = math.Sin(angle)
+	}
+	bits := 0
+	for (1 << bits) < n {
+		bits++
+	}
+	for i := range f.reversed {
+		r := 0
+		for b := 0; b < bits; b++ {
+			if i&(1<<b) != 0 {
+				r |= 1 << (bits - 1 - b)
+			}
+		}
+		f.reversed[i] = r
+	}
+	return f
+}
+
+// transform performs an in-place forward FFT.
+// Both slices must have the length of f.n.
+func (f *fft) transform(re, im []float64) {
+	for i, j := range f.reversed {
+		if i < j {
+			re[i], re[j] = re[j], re[i]
+			im[i], im[j] = im[j], im[i]
+		}
+	}
+
+	for size := 2; size <= f.n; size *= 2 {
+		half := size / 2
+		step := f.n / size
+		for start := 0; start < f.n; start += size {
+			for k := 0; k < half; k++ {
+				wr := f.cos[k*step]
+				wi := f.sin[k*step]
+				a := start + k
+				b := a + half
+				tr := re[b]*wr - im[b]*wi
+				ti := re[b]*wi + im[b]*wr
+				re[b] = re[a] - tr
+				im[b] = im[a] - ti
+				re[a] += tr
+				im[a] += ti
+			}
+		}
+	}
+}
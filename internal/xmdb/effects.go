@@ -117,6 +117,10 @@ const (
 	// Encoding effect=0x09
 	// Arg: offset
 	EffectSampleOffset
+
+	// Encoding: effect type is configurable (it's not a part of XM spec)
+	// Arg: marker payload
+	EffectMarker
 )
 
 func ConvertEffect(n xmfile.PatternNote) (Effect, error) {
@@ -176,6 +180,7 @@ func ConvertEffect(n xmfile.PatternNote) (Effect, error) {
 			e.Arg = e.Arg & 0x0f
 		case 0x0C:
 			e.Op = EffectNoteCut
+			e.Arg = e.Arg & 0x0f
 		case 0x0D:
 			err = fmt.Errorf("unsupported 0x0E note delay: %02x => %02X", n.EffectType, e.Arg)
 		default:
@@ -0,0 +1,120 @@
+package xm
+
+import (
+	"math"
+	"sync"
+)
+
+// InterpolationMode selects how the sample values between the
+// source sample points are computed during the playback.
+//
+// The precomputed mode trades memory for CPU: the sub-samples
+// are generated during the module compilation.
+// The realtime modes (linear, cubic and sinc) keep the samples as is
+// and interpolate them on the fly using the fractional sample offset,
+// trading CPU for memory.
+type InterpolationMode int
+
+const (
+	// InterpolationNone plays the nearest (lower) sample point.
+	// This is the fastest mode and it also requires the least amount of memory.
+	InterpolationNone InterpolationMode = iota
+
+	// InterpolationLinearPrecomputed inserts 1-7 lerped sub-samples
+	// per source sample during the module compilation.
+	// The exact number of sub-samples depends on the sample length.
+	// On average, this option will make loaded track to require ~x2 memory.
+	// The playback speed is identical to InterpolationNone.
+	InterpolationLinearPrecomputed
+
+	// InterpolationLinear performs a realtime linear interpolation
+	// between the two nearest sample points.
+	InterpolationLinear
+
+	// InterpolationCubic performs a realtime 4-point cubic (Catmull-Rom) interpolation.
+	InterpolationCubic
+
+	// InterpolationSinc performs a realtime 8-point windowed sinc interpolation.
+	// This is the highest quality mode and also the most CPU-demanding one.
+	InterpolationSinc
+)
+
+const (
+	sincTaps       = 8
+	sincPhases     = 256
+	sincHalfWindow = sincTaps / 2
+)
+
+// sincTable holds the precomputed Lanczos-windowed sinc weights.
+// The table is shared by all streams and it's initialized
+// only once, when the first sinc-interpolated module is compiled.
+var (
+	sincTable     [sincPhases][sincTaps]float32
+	sincTableOnce sync.Once
+)
+
+func initSincTable() {
+	sincTableOnce.Do(func() {
+		for phase := range sincTable {
+			frac := float64(phase) / sincPhases
+			sum := 0.0
+			var weights [sincTaps]float64
+			for k := range weights {
+				x := float64(k-sincHalfWindow+1) - frac
+				w := sinc(x) * sinc(x/sincHalfWindow)
+				weights[k] = w
+				sum += w
+			}
+			for k, w := range weights {
+				sincTable[phase][k] = float32(w / sum)
+			}
+		}
+	})
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	x *= math.Pi
+	return math.Sin(x) / x
+}
+
+// sampleAt returns a sample value at the specified position,
+// taking the instrument loop into account.
+// Out of bounds positions are treated as silence.
+func (ch *streamChannel) sampleAt(i int) float64 {
+	inst := ch.inst
+	if float64(i) >= inst.loopEnd {
+		i -= int(inst.loopLength)
+	}
+	if i < 0 || i >= len(inst.samples) {
+		return 0
+	}
+	return float64(inst.samples[i])
+}
+
+func (ch *streamChannel) linearSample(i int) int16 {
+	t := ch.sampleOffset - float64(i)
+	return int16(lerp(float64(ch.inst.samples[i]), ch.sampleAt(i+1), t))
+}
+
+func (ch *streamChannel) cubicSample(i int) int16 {
+	t := ch.sampleOffset - float64(i)
+	y0 := ch.sampleAt(i - 1)
+	y1 := float64(ch.inst.samples[i])
+	y2 := ch.sampleAt(i + 1)
+	y3 := ch.sampleAt(i + 2)
+	v := y1 + 0.5*t*(y2-y0+t*(2*y0-5*y1+4*y2-y3+t*(3*(y1-y2)+y3-y0)))
+	return int16(clamp(v, math.MinInt16, math.MaxInt16))
+}
+
+func (ch *streamChannel) sincSample(i int) int16 {
+	phase := int((ch.sampleOffset - float64(i)) * sincPhases)
+	weights := &sincTable[phase&(sincPhases-1)]
+	v := 0.0
+	for k, w := range weights {
+		v += float64(w) * ch.sampleAt(i+k-sincHalfWindow+1)
+	}
+	return int16(clamp(v, math.MinInt16, math.MaxInt16))
+}
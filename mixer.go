@@ -0,0 +1,251 @@
+package xm
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sync"
+)
+
+// Mixer combines several streams into a single PCM stream.
+//
+// Mixer produces the same 16-bit signed LE PCM data as Stream does,
+// so it can be used as an io.Reader argument for audio.NewPlayer().
+// This way a single audio player can handle the music transitions,
+// like crossfading from one song to another, in a sample-accurate way.
+//
+// Every mixed stream has its own gain that can be automated via fades.
+// All streams must have the same sample rate.
+//
+// Mixer never ends: when there are no streams to mix, it produces silence.
+// A stream that reached its end is removed from the mixer automatically.
+//
+// The Mixer and MixerTrack methods are concurrency-safe: they can be called
+// from the game loop while the audio player reads the mixer on its own goroutine.
+// They should not be called from the event handlers of the mixed streams
+// (see Stream.SetEventHandler), as the handlers are executed during the Read call;
+// use an EventQueue instead.
+// To change the mixed stream settings, use its controller (see Stream.Controller).
+type Mixer struct {
+	// mu protects the tracks and their gain and fade state.
+	// It's held during the entire Read call.
+	mu sync.Mutex
+
+	tracks []*MixerTrack
+
+	readBuf []byte
+	mixBuf  []int32
+}
+
+// MixerTrack is a stream that is attached to a Mixer.
+// Use Mixer.AddStream to create a track.
+type MixerTrack struct {
+	mixer  *Mixer
+	stream *Stream
+
+	gain float64
+
+	// Fade automation state.
+	fadeTarget float64
+	fadeStep   float64 // A per-frame gain delta
+	fadeFrames int     // How many frames are remaining
+	fadeRemove bool    // Whether to remove the track after the fade is completed
+
+	removed bool
+}
+
+// NewMixer creates an empty mixer.
+// Use AddStream method to add streams to it.
+func NewMixer() *Mixer {
+	return &Mixer{}
+}
+
+// AddStream attaches a stream to the mixer with the specified initial gain.
+// The gain value is clamped in [0, 1].
+//
+// The stream should have a module assigned.
+// An error is returned if the stream sample rate doesn't match the other streams.
+//
+// Note that the stream is consumed by the mixer:
+// it should not be used as an audio player source directly.
+func (m *Mixer) AddStream(s *Stream, gain float64) (*MixerTrack, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.tracks) != 0 && m.tracks[0].stream.module.sampleRate != s.module.sampleRate {
+		return nil, errors.New("mismatching stream sample rates")
+	}
+	t := &MixerTrack{
+		mixer:  m,
+		stream: s,
+		gain:   clamp(gain, 0, 1),
+	}
+	m.tracks = append(m.tracks, t)
+	return t, nil
+}
+
+// NumTracks reports the number of currently mixed tracks.
+func (m *Mixer) NumTracks() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.tracks)
+}
+
+// Stream returns the track stream.
+func (t *MixerTrack) Stream() *Stream {
+	return t.stream
+}
+
+// Gain returns the current track gain.
+// It can be changing over time if there is an active fade.
+func (t *MixerTrack) Gain() float64 {
+	t.mixer.mu.Lock()
+	defer t.mixer.mu.Unlock()
+	return t.gain
+}
+
+// IsRemoved reports whether the track is no longer mixed.
+// The track is removed by the Remove call, after FadeOut or when its stream ends.
+func (t *MixerTrack) IsRemoved() bool {
+	t.mixer.mu.Lock()
+	defer t.mixer.mu.Unlock()
+	return t.removed
+}
+
+// SetGain changes the track gain immediately.
+// It cancels the active fade (if any).
+// The value is clamped in [0, 1].
+func (t *MixerTrack) SetGain(gain float64) {
+	t.mixer.mu.Lock()
+	defer t.mixer.mu.Unlock()
+	t.gain = clamp(gain, 0, 1)
+	t.fadeFrames = 0
+	t.fadeRemove = false
+}
+
+// FadeTo changes the track gain linearly to the specified value during the given time (in seconds).
+// It replaces the active fade (if any).
+// The gain value is clamped in [0, 1].
+func (t *MixerTrack) FadeTo(gain, seconds float64) {
+	t.mixer.mu.Lock()
+	defer t.mixer.mu.Unlock()
+	t.startFade(gain, int(seconds*t.stream.module.sampleRate), false)
+}
+
+// FadeToTicks is like FadeTo, but its duration is specified in the track stream ticks.
+// The current stream BPM is used to convert ticks to samples.
+func (t *MixerTrack) FadeToTicks(gain float64, ticks int) {
+	t.mixer.mu.Lock()
+	defer t.mixer.mu.Unlock()
+	t.startFade(gain, ticks*int(t.stream.samplesPerTick), false)
+}
+
+// FadeOut is like FadeTo(0, seconds), but the track is removed
+// from the mixer after the fade is completed.
+func (t *MixerTrack) FadeOut(seconds float64) {
+	t.mixer.mu.Lock()
+	defer t.mixer.mu.Unlock()
+	t.startFade(0, int(seconds*t.stream.module.sampleRate), true)
+}
+
+// Remove detaches the track from the mixer.
+func (t *MixerTrack) Remove() {
+	t.mixer.mu.Lock()
+	defer t.mixer.mu.Unlock()
+	t.remove()
+}
+
+func (t *MixerTrack) remove() {
+	if t.removed {
+		return
+	}
+	t.removed = true
+	t.mixer.collectRemoved()
+}
+
+func (t *MixerTrack) startFade(gain float64, frames int, remove bool) {
+	gain = clamp(gain, 0, 1)
+	t.fadeRemove = remove
+	if frames <= 0 {
+		t.gain = gain
+		t.fadeFrames = 0
+		if remove {
+			t.remove()
+		}
+		return
+	}
+	t.fadeTarget = gain
+	t.fadeFrames = frames
+	t.fadeStep = (gain - t.gain) / float64(frames)
+}
+
+// Read puts the next mixed PCM bytes into provided slice.
+//
+// It always fills the entire slice (rounded down to the whole stereo frames).
+func (m *Mixer) Read(b []byte) (int, error) {
+	n := len(b) &^ 0b11
+	b = b[:n]
+	numSamples := n / 2
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if cap(m.mixBuf) < numSamples {
+		m.mixBuf = make([]int32, numSamples)
+		m.readBuf = make([]byte, n)
+	}
+	mix := m.mixBuf[:numSamples]
+	clear(mix)
+
+	removed := false
+	for _, t := range m.tracks {
+		if !t.mix(mix, m.readBuf[:n]) {
+			t.removed = true
+			removed = true
+		}
+	}
+	if removed {
+		m.collectRemoved()
+	}
+
+	for i, v := range mix {
+		binary.LittleEndian.PutUint16(b[i*2:], uint16(int16(clamp(int(v), math.MinInt16, math.MaxInt16))))
+	}
+
+	return n, nil
+}
+
+func (m *Mixer) collectRemoved() {
+	tracks := m.tracks[:0]
+	for _, t := range m.tracks {
+		if !t.removed {
+			tracks = append(tracks, t)
+		}
+	}
+	clear(m.tracks[len(tracks):])
+	m.tracks = tracks
+}
+
+// mix adds the track samples to the dst.
+// It returns false if this track should be removed.
+func (t *MixerTrack) mix(dst []int32, buf []byte) bool {
+	n, err := t.stream.Read(buf)
+	buf = buf[:n]
+
+	for i := 0; i+4 <= len(buf); i += 4 {
+		if t.fadeFrames != 0 {
+			t.fadeFrames--
+			t.gain += t.fadeStep
+			if t.fadeFrames == 0 {
+				t.gain = t.fadeTarget
+			}
+		}
+		left := int16(binary.LittleEndian.Uint16(buf[i:]))
+		right := int16(binary.LittleEndian.Uint16(buf[i+2:]))
+		dst[i/2] += int32(float64(left) * t.gain)
+		dst[i/2+1] += int32(float64(right) * t.gain)
+	}
+
+	ended := err != nil || (t.fadeRemove && t.fadeFrames == 0)
+	return !ended
+}
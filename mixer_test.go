@@ -0,0 +1,187 @@
+package xm
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMixerConcurrentUse(t *testing.T) {
+	m := NewMixer()
+	current, err := m.AddStream(newTestStream(t), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var numReads atomic.Int64
+	waitRead := func() {
+		n := numReads.Load()
+		for numReads.Load() == n {
+			runtime.Gosched()
+		}
+	}
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		// This goroutine acts like an audio player.
+		defer wg.Done()
+		buf := make([]byte, 4096)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				_, _ = m.Read(buf)
+				numReads.Add(1)
+			}
+		}
+	}()
+
+	for i := 0; i < 20; i++ {
+		s := newTestStream(t)
+		s.SetLooping(true)
+		next, err := m.AddStream(s, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		current.FadeOut(0.01)
+		next.FadeTo(1, 0.01)
+		next.FadeToTicks(0.5, 2)
+		_ = current.Gain()
+		_ = current.IsRemoved()
+		_ = m.NumTracks()
+		current = next
+		waitRead()
+	}
+	current.Remove()
+
+	close(done)
+	wg.Wait()
+
+	if !current.IsRemoved() {
+		t.Fatal("the removed track is not marked as removed")
+	}
+}
+
+func TestMixerGainAndRemoval(t *testing.T) {
+	readSamples := func(r io.Reader, numFrames int) []int16 {
+		t.Helper()
+		buf := make([]byte, numFrames*4)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			t.Fatal(err)
+		}
+		samples := make([]int16, numFrames*2)
+		for i := range samples {
+			samples[i] = int16(binary.LittleEndian.Uint16(buf[i*2:]))
+		}
+		return samples
+	}
+
+	// The reference output of the mixed stream.
+	const numFrames = 4000
+	ref := readSamples(newTestStream(t), numFrames)
+	pos := 0 // The current reference frame
+
+	m := NewMixer()
+	track, err := m.AddStream(newTestStream(t), 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// checkRead reads n frames from the mixer;
+	// gainAt returns the expected gain for every frame.
+	checkRead := func(stage string, n int, gainAt func(i int) float64) {
+		t.Helper()
+		samples := readSamples(m, n)
+		for i := 0; i < n; i++ {
+			g := gainAt(i)
+			for j := 0; j < 2; j++ {
+				want := int16(int32(float64(ref[(pos+i)*2+j]) * g))
+				if have := samples[i*2+j]; have != want {
+					t.Fatalf("%s: frame %d sample %d mismatch:\nhave %d\nwant %d", stage, i, j, have, want)
+				}
+			}
+		}
+		pos += n
+	}
+	checkGain := func(stage string, want float64) {
+		t.Helper()
+		if have := track.Gain(); math.Abs(have-want) > 1e-9 {
+			t.Fatalf("%s: gain mismatch:\nhave %f\nwant %f", stage, have, want)
+		}
+	}
+
+	checkRead("initial gain", 500, func(i int) float64 { return 0.5 })
+	checkGain("initial gain", 0.5)
+
+	// fadeGain mimics the mixer fade: the gain is changed on every frame.
+	fadeGain := func(from, to float64, frames int) func(i int) float64 {
+		g := from
+		step := (to - from) / float64(frames)
+		return func(i int) float64 {
+			if frames == 0 {
+				return g
+			}
+			frames--
+			g += step
+			if frames == 0 {
+				g = to
+			}
+			return g
+		}
+	}
+
+	// 441 frames at 44100 sample rate.
+	track.FadeTo(1, 0.01)
+	checkRead("fade to", 500, fadeGain(0.5, 1, 441))
+	checkGain("fade to", 1)
+
+	// One tick is 882 frames long.
+	track.FadeToTicks(0.25, 1)
+	gainAt := fadeGain(1, 0.25, 882)
+	checkRead("fade to ticks (half)", 441, gainAt)
+	checkGain("fade to ticks (half)", 1-0.75*0.5)
+	checkRead("fade to ticks", 559, gainAt)
+	checkGain("fade to ticks", 0.25)
+	if track.IsRemoved() {
+		t.Fatal("a track is removed after FadeToTicks")
+	}
+
+	track.FadeOut(0.01)
+	readSamples(m, 441)
+	if !track.IsRemoved() || m.NumTracks() != 0 {
+		t.Fatalf("a track is not removed after FadeOut: removed=%v tracks=%d", track.IsRemoved(), m.NumTracks())
+	}
+	for i, v := range readSamples(m, 100) {
+		if v != 0 {
+			t.Fatalf("sample %d is not silent after the track removal: %d", i, v)
+		}
+	}
+
+	// A stream that reaches its end is removed too.
+	s := newTestStream(t)
+	s.SetMaxDuration(0.01)
+	track, err = m.AddStream(s, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pos = 0
+	checkRead("ending stream", 441, func(i int) float64 { return 1 })
+	if track.IsRemoved() {
+		t.Fatal("the track is removed before its stream ended")
+	}
+	for i, v := range readSamples(m, 100) {
+		if v != 0 {
+			t.Fatalf("sample %d is not silent after the stream end: %d", i, v)
+		}
+	}
+	if !track.IsRemoved() || m.NumTracks() != 0 {
+		t.Fatalf("a track is not removed after its stream ended: removed=%v tracks=%d", track.IsRemoved(), m.NumTracks())
+	}
+}
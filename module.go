@@ -1,22 +1,85 @@
 package xm
 
 import (
+	"errors"
+
 	"github.com/quasilyte/xm/internal/xmdb"
 	"github.com/quasilyte/xm/xmfile"
 )
 
+// CompiledModule is an XM module converted into a form that is optimized for playing.
+//
+// Use Compile function to create a compiled module.
+//
+// A compiled module is immutable. It can be attached to any number
+// of streams via Stream.SetModule, the sample and pattern data will be shared
+// between them. It's safe to play these streams from different goroutines.
+type CompiledModule struct {
+	data module
+}
+
+// Compile converts an XM module into a playable form.
+//
+// Compiling a module is a slow process.
+// You want to compile modules as rarely as possible (preferably exactly once)
+// and then play them via streams without ever releasing the memory.
+func Compile(m *xmfile.Module, config LoadModuleConfig) (*CompiledModule, error) {
+	applyConfigDefaults(m, &config)
+
+	if config.SampleRate != 44100 {
+		return nil, errors.New("unsupported sample rate (only 44100 is supported)")
+	}
+
+	compiled, err := compileModule(m, moduleConfig{
+		sampleRate:    config.SampleRate,
+		bpm:           config.BPM,
+		tempo:         config.Tempo,
+		interpolation: config.Interpolation,
+		markerEffect:  config.MarkerEffect,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &CompiledModule{data: compiled}, nil
+}
+
+func applyConfigDefaults(m *xmfile.Module, config *LoadModuleConfig) {
+	if config.SampleRate == 0 {
+		config.SampleRate = 44100
+	}
+	if config.Interpolation == InterpolationNone && config.LinearInterpolation {
+		config.Interpolation = InterpolationLinearPrecomputed
+	}
+	if config.BPM == 0 {
+		config.BPM = uint(m.DefaultBPM)
+		if config.BPM == 0 {
+			config.BPM = 120
+		}
+	}
+	if config.Tempo == 0 {
+		config.Tempo = uint(m.DefaultTempo)
+		if config.Tempo == 0 {
+			config.Tempo = 6
+		}
+	}
+}
+
 type module struct {
 	instruments []instrument
 
+	numChannels int
+
 	patterns     []pattern
 	patternOrder []*pattern
 
 	effectTab []noteEffect
 	noteTab   []patternNote
 
-	sampleRate  float64
-	bpm         float64
-	ticksPerRow int
+	sampleRate    float64
+	bpm           float64
+	ticksPerRow   int
+	interpolation InterpolationMode
 
 	// These values store the defaults for the stream.
 	samplesPerTick float64
@@ -25,18 +88,23 @@ type module struct {
 }
 
 type moduleConfig struct {
-	sampleRate uint
-	bpm        uint
-	tempo      uint
-	subSamples bool
+	sampleRate    uint
+	bpm           uint
+	tempo         uint
+	interpolation InterpolationMode
+	markerEffect  uint8
 }
 
 type pattern struct {
+	id          int // An index inside module.patterns
 	numChannels int
 	numRows     int
 	notes       []uint16
 }
 
+// keyOffNote is a special XM note value that releases the current note.
+const keyOffNote = 97
+
 type patternNote struct {
 	inst   *instrument
 	period float64
@@ -104,6 +172,8 @@ type instrument struct {
 	numSubSamples int
 	id            int
 
+	interpolation InterpolationMode
+
 	sample16bit bool
 }
 
@@ -19,8 +19,10 @@ type moduleCompiler struct {
 
 	samplePool []int16
 
-	subSamples bool
-	isSynth    bool
+	interpolation InterpolationMode
+	subSamples    bool
+	markerEffect  uint8
+	isSynth       bool
 }
 
 func newSynthCompiler() *moduleCompiler {
@@ -33,16 +35,23 @@ func newSynthCompiler() *moduleCompiler {
 
 func compileModule(m *xmfile.Module, config moduleConfig) (module, error) {
 	c := &moduleCompiler{
-		effectBuf:  make([]xmdb.Effect, 0, 4),
-		effectSet:  make(map[uint64]effectKey, 24),
-		subSamples: config.subSamples,
+		effectBuf:     make([]xmdb.Effect, 0, 4),
+		effectSet:     make(map[uint64]effectKey, 24),
+		interpolation: config.interpolation,
+		subSamples:    config.interpolation == InterpolationLinearPrecomputed,
+		markerEffect:  config.markerEffect,
 	}
 	compiled := module{
-		effectTab:   make([]noteEffect, 0, 24),
-		sampleRate:  float64(config.sampleRate),
-		bpm:         float64(config.bpm),
-		ticksPerRow: int(config.tempo),
-		noteTab:     make([]patternNote, len(m.Notes)),
+		effectTab:     make([]noteEffect, 0, 24),
+		sampleRate:    float64(config.sampleRate),
+		bpm:           float64(config.bpm),
+		ticksPerRow:   int(config.tempo),
+		interpolation: config.interpolation,
+		numChannels:   m.NumChannels,
+		noteTab:       make([]patternNote, len(m.Notes)),
+	}
+	if config.interpolation == InterpolationSinc {
+		initSincTable()
 	}
 	c.result = &compiled
 	err := c.compile(m)
@@ -190,6 +199,7 @@ func (c *moduleCompiler) loadInstrumentSample(inst *instrument, sample *xmfile.I
 
 	inst.samples = dstSamples
 	inst.sampleStepMultiplier = 1.0
+	inst.interpolation = c.interpolation
 	if c.subSamples {
 		c.insertSubSamples(inst, sample, sampleSize)
 	}
@@ -381,11 +391,17 @@ func (c *moduleCompiler) compileNote(rawNote xmfile.PatternNote) (patternNote, b
 	}
 
 	e1 := xmdb.Effect{}
-	if rawNote.Note == 97 {
+	if rawNote.Note == keyOffNote {
 		e1.Op = xmdb.EffectEarlyKeyOff
 	}
 	e2 := xmdb.EffectFromVolumeByte(rawNote.Volume)
-	e3, warnErr := xmdb.ConvertEffect(rawNote)
+	var e3 xmdb.Effect
+	var warnErr error
+	if c.markerEffect != 0 && rawNote.EffectType == c.markerEffect {
+		e3 = xmdb.Effect{Op: xmdb.EffectMarker, Arg: rawNote.EffectParameter}
+	} else {
+		e3, warnErr = xmdb.ConvertEffect(rawNote)
+	}
 	ek, err := c.compileEffect(e1, e2, e3)
 	if err != nil {
 		return n, false, err
@@ -426,6 +442,9 @@ func (c *moduleCompiler) compileNote(rawNote xmfile.PatternNote) (patternNote, b
 func (c *moduleCompiler) compilePatterns(m *xmfile.Module) error {
 	c.result.patterns = make([]pattern, m.NumPatterns)
 	c.result.patternOrder = make([]*pattern, len(m.PatternOrder))
+	for i := range c.result.patterns {
+		c.result.patterns[i].id = i
+	}
 
 	// Bind pattern order to the actual patterns.
 	for i, patternIndex := range m.PatternOrder {
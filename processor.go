@@ -0,0 +1,54 @@
+package xm
+
+import (
+	"math"
+)
+
+// Processor is a post-mix audio effect, like a filter or a reverb.
+// Use Stream.SetProcessors to install the processors.
+// See the xm/dsp package for some ready-to-use implementations.
+//
+// The processors are applied to every rendered tick, right after the mixing.
+// The spectrum analysis (see Stream.EnableSpectrum) observes the processed audio.
+type Processor interface {
+	// Process modifies the interleaved stereo samples in place.
+	// The samples are in [-1, 1] range (the output is clamped to this range
+	// after all processors are applied).
+	//
+	// It's called from the goroutine that reads the stream.
+	Process(samples []float32, sampleRate int)
+}
+
+// SetProcessors replaces the post-mix processors list.
+// The processors are applied in the specified order.
+// Calling it without arguments removes all processors.
+//
+// The processors are stateful, so a processor should not be shared between streams.
+func (s *Stream) SetProcessors(processors ...Processor) {
+	s.settings.processors = append(s.settings.processors[:0], processors...)
+}
+
+func (s *Stream) applyProcessors(pcm []byte) {
+	numSamples := len(pcm) / 2
+	if cap(s.processBuf) < numSamples {
+		s.processBuf = make([]float32, numSamples)
+	}
+	buf := s.processBuf[:numSamples]
+
+	for i := range buf {
+		v := int16(uint16(pcm[i*2]) | uint16(pcm[i*2+1])<<8)
+		buf[i] = float32(v) / 32768
+	}
+
+	sampleRate := int(s.module.sampleRate)
+	for _, p := range s.settings.processors {
+		p.Process(buf, sampleRate)
+	}
+
+	for i, v := range buf {
+		v = clamp(v*32768, math.MinInt16, math.MaxInt16)
+		x := uint16(int16(v))
+		pcm[i*2] = byte(x)
+		pcm[i*2+1] = byte(x >> 8)
+	}
+}
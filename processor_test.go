@@ -0,0 +1,64 @@
+package xm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"testing"
+)
+
+type testProcessor struct {
+	gain       float32
+	sampleRate int
+}
+
+func (p *testProcessor) Process(samples []float32, sampleRate int) {
+	p.sampleRate = sampleRate
+	for i := range samples {
+		samples[i] *= p.gain
+	}
+}
+
+func TestStreamProcessors(t *testing.T) {
+	const numFrames = 20 * 882
+
+	render := func(processors ...Processor) []byte {
+		t.Helper()
+		s := newTestStream(t)
+		s.SetProcessors(processors...)
+		buf := make([]byte, numFrames*4)
+		if _, err := io.ReadFull(s, buf); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		return buf
+	}
+
+	want := render()
+
+	// A processor that doesn't change the samples should keep the PCM intact.
+	p := &testProcessor{gain: 1}
+	have := render(p)
+	if p.sampleRate != 44100 {
+		t.Fatalf("processor sample rate is %d, want 44100", p.sampleRate)
+	}
+	if !bytes.Equal(have, want) {
+		t.Fatal("no-op processor changed the PCM data")
+	}
+
+	// The processors are applied in order and the result is clamped.
+	have = render(&testProcessor{gain: 100}, &testProcessor{gain: 2})
+	clipped := false
+	for i := 0; i < len(want); i += 2 {
+		ref := int16(binary.LittleEndian.Uint16(want[i:]))
+		v := int16(binary.LittleEndian.Uint16(have[i:]))
+		expected := int16(clamp(float32(ref)*200, math.MinInt16, math.MaxInt16))
+		if v != expected {
+			t.Fatalf("sample %d mismatch:\nhave %d\nwant %d", i/2, v, expected)
+		}
+		clipped = clipped || v == math.MaxInt16 || v == math.MinInt16
+	}
+	if !clipped {
+		t.Fatal("the amplified signal is not clamped")
+	}
+}
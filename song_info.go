@@ -0,0 +1,126 @@
+package xm
+
+import (
+	"github.com/quasilyte/xm/internal/xmdb"
+)
+
+// SongInfo describes the song timing.
+// Use CompiledModule.AnalyzeSong to get it.
+type SongInfo struct {
+	// Duration is the song length in seconds.
+	//
+	// For a song that loops back via a jump effect, it's the
+	// time it takes to reach the jump target for the second time.
+	// In other words, it's a duration of a single song iteration.
+	// See Loops for the details.
+	Duration float64
+
+	// OrderStartTimes contains the times (in seconds) when every
+	// pattern order entry starts playing for the first time.
+	// If some entry is never played (e.g. it's skipped by a jump), its start time is -1.
+	OrderStartTimes []float64
+
+	// Loops reports whether the song loops back to an already played
+	// position via a jump effect.
+	// The jump target is described by LoopOrder and LoopRow.
+	//
+	// Note that the backward jumps (like Bxx) are not supported yet:
+	// the only supported jump effect is Dxx which always moves forward.
+	// Therefore, this field is always false for now (and the loop position is -1).
+	Loops bool
+
+	LoopOrder int
+	LoopRow   int
+}
+
+// AnalyzeSong computes the song timing without rendering it.
+//
+// It walks the pattern order applying the timing effects (like Fxx and Dxx),
+// but it doesn't mix any audio, so it's very fast.
+// This method doesn't take any Stream settings (like looping) into account.
+func (m *CompiledModule) AnalyzeSong() SongInfo {
+	return analyzeSong(&m.data)
+}
+
+func analyzeSong(m *module) SongInfo {
+	numOrders := len(m.patternOrder)
+
+	info := SongInfo{
+		OrderStartTimes: make([]float64, numOrders),
+		LoopOrder:       -1,
+		LoopRow:         -1,
+	}
+	for i := range info.OrderStartTimes {
+		info.OrderStartTimes[i] = -1
+	}
+
+	// Every (order, row) pair is visited at most once.
+	// A second visit means that we found a loop.
+	rowOffsets := make([]int, numOrders)
+	numRows := 0
+	for i, p := range m.patternOrder {
+		rowOffsets[i] = numRows
+		numRows += p.numRows
+	}
+	visited := make([]bool, numRows)
+
+	bpm := m.bpm
+	ticksPerRow := m.ticksPerRow
+	t := 0.0
+
+	order := 0
+	row := 0
+	for order < numOrders {
+		if info.OrderStartTimes[order] < 0 {
+			info.OrderStartTimes[order] = t
+		}
+
+		p := m.patternOrder[order]
+		k := rowOffsets[order] + row
+		if visited[k] {
+			info.Loops = true
+			info.LoopOrder = order
+			info.LoopRow = row
+			break
+		}
+		visited[k] = true
+
+		nextOrder := order
+		nextRow := row + 1
+
+		noteOffset := p.numChannels * row
+		for _, noteID := range p.notes[noteOffset : noteOffset+p.numChannels] {
+			n := &m.noteTab[noteID]
+			numEffects := n.effect.Len()
+			offset := n.effect.Index()
+			for _, e := range m.effectTab[offset : offset+numEffects] {
+				// Only the effects that affect the song timing are interesting here.
+				switch e.op {
+				case xmdb.EffectSetTempo:
+					ticksPerRow = int(e.rawValue)
+				case xmdb.EffectSetBPM:
+					bpm = e.floatValue
+				case xmdb.EffectPatternBreak:
+					nextOrder = order + 1
+					nextRow = int(e.arp[0])
+				}
+			}
+		}
+
+		t += float64(ticksPerRow) / ticksPerSecond(bpm)
+
+		if nextOrder == order && nextRow >= p.numRows {
+			nextOrder++
+			nextRow = 0
+		}
+		if nextOrder < numOrders && nextRow >= m.patternOrder[nextOrder].numRows {
+			nextRow = 0
+		}
+		order = nextOrder
+		row = nextRow
+	}
+
+	info.Duration = t
+
+	return info
+}
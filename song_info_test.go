@@ -0,0 +1,57 @@
+package xm
+
+import (
+	"io"
+	"math"
+	"testing"
+)
+
+func TestAnalyzeSong(t *testing.T) {
+	compiled, err := Compile(newTestModule(
+		testEffect{pattern: 0, row: 4, op: 0x0F, arg: 0x03}, // Tempo=3
+		testEffect{pattern: 0, row: 8, op: 0x0F, arg: 0x96}, // BPM=150
+		testEffect{pattern: 1, row: 2, op: 0x0D, arg: 0x08}, // Break to the next order, row 8
+	), LoadModuleConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := compiled.AnalyzeSong()
+
+	// Render the song and record the actual order start times.
+	s := NewStream()
+	s.SetModule(compiled)
+	var orderTimes []float64
+	s.SetEventHandler(func(e StreamEvent) {
+		if e.Kind == EventOrderChange {
+			orderTimes = append(orderTimes, float64(e.SampleOffset)/44100)
+		}
+	})
+	n, err := io.Copy(io.Discard, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	duration := float64(n/4) / 44100
+
+	const eps = 1e-9
+	if math.Abs(info.Duration-duration) > eps {
+		t.Fatalf("duration mismatch:\nhave %f\nwant %f (rendered)", info.Duration, duration)
+	}
+	if math.Abs(info.Duration-1.67) > eps {
+		t.Fatalf("duration mismatch:\nhave %f\nwant %f", info.Duration, 1.67)
+	}
+
+	if len(info.OrderStartTimes) != len(orderTimes) {
+		t.Fatalf("order start times length mismatch:\nhave %d\nwant %d", len(info.OrderStartTimes), len(orderTimes))
+	}
+	for i, want := range []float64{0, 1.12, 1.27} {
+		have := info.OrderStartTimes[i]
+		if math.Abs(have-orderTimes[i]) > eps || math.Abs(have-want) > eps {
+			t.Fatalf("order %d start time mismatch:\nhave %f\nwant %f (rendered: %f)", i, have, want, orderTimes[i])
+		}
+	}
+
+	if info.Loops || info.LoopOrder != -1 || info.LoopRow != -1 {
+		t.Fatalf("unexpected loop info: %v %d %d", info.Loops, info.LoopOrder, info.LoopRow)
+	}
+}
@@ -13,8 +13,15 @@ import (
 //
 // The Read() method produces 16-bit little endian PCM bytes; this is what ebiten/audio
 // package extects. Use Stream as an io.Reader argument for audio.NewPlayer().
+//
+// Stream is not safe for concurrent use. If the stream is being read
+// on another goroutine (like in case of the audio player),
+// use its Controller to change the playback settings.
+// See Controller docs to learn which methods are concurrency-safe.
 type Stream struct {
-	module module
+	module *module
+
+	controller *StreamController
 
 	pattern           *pattern
 	patternIndex      int
@@ -28,6 +35,19 @@ type Stream struct {
 	jumpPattern int
 	jumpRow     int
 
+	queuedJump queuedJump
+
+	// The number of completed loop iterations.
+	// See SetLoopRange, SetLooping and SetLoopCount.
+	rangeLoopsDone int
+	songLoopsDone  int
+
+	// songEnded is set when the stream reaches its end.
+	// It's used to emit the EventSongEnd only once.
+	songEnded bool
+
+	fade streamFade
+
 	settings streamSettings
 
 	// These values can change during the playback.
@@ -36,18 +56,59 @@ type Stream struct {
 	samplesPerTick float64
 	ticksPerRow    int // Also known as "tempo" and "spd"
 	bytesPerTick   int
-	bytePos        int // Used to report the current pos via Seek()
-	t              float64
-	secondsPerRow  float64
+	bytePos        int     // Used to report the current pos via Seek()
+	playedBytes    int     // Unlike bytePos, it's not reset by the looping
+	t              float64 // The current tick start time (in seconds)
+	secondsPerTick float64
+
+	// tickBuf is used to render a tick that doesn't fit the Read() slice.
+	// tickPending is a part of tickBuf that was not consumed yet.
+	tickBuf     []byte
+	tickPending []byte
+
+	// processBuf is used to convert PCM data for the processors.
+	processBuf []float32
 
 	channels       []streamChannel
 	activeChannels []*streamChannel
 }
 
 type streamSettings struct {
-	volumeScaling float64
-	loop          bool
-	eventHandler  func(e StreamEvent)
+	volumeScaling   float64
+	speedMultiplier float64
+	pitchMultiplier float64
+	loop            bool
+	loopCount       int
+	loopRange       loopRange
+	maxDuration     float64
+	eventHandler    func(e StreamEvent)
+	eventQueue      *EventQueue
+	eventsEnabled   bool // Whether there is a handler or a queue
+
+	// meter and spectrum are only allocated when they're enabled.
+	meter    *streamMeter
+	spectrum *streamSpectrum
+
+	processors []Processor
+
+	// Per-channel playback controls.
+	// The slice length always matches the number of stream channels.
+	channels []channelSettings
+	numSolo  int
+
+	// Per-instrument volume scaling, indexed by the instrument ID.
+	// The slice length always matches the number of module instruments.
+	instrumentVolume []float64
+}
+
+type channelSettings struct {
+	// gain is a final volume multiplier computed from
+	// the other fields (and the solo state of other channels).
+	gain float64
+
+	volume float64
+	muted  bool
+	solo   bool
 }
 
 type jumpKind uint8
@@ -55,18 +116,28 @@ type jumpKind uint8
 const (
 	jumpNone jumpKind = iota
 	jumpPatternBreak
+	jumpQueued
+	jumpLoop
 )
 
 // StreamInfo contains a compiled XM module stream information like bytes per tick, etc.
 type StreamInfo struct {
 	// BytesPerTick tell how much bytes this stream needs to fit a single XM tick.
-	// This value is important, since any slice smaller than this will give no effect
-	// for Read() function. Any greater values will work OK for it.
+	// Read() works with slices of any size, but the slices smaller than
+	// this value require an extra copying via the internal tick buffer.
 	BytesPerTick uint
 
+	// NumChannels is the number of XM module channels.
+	// The channel-related Stream methods expect a channel index in [0, NumChannels).
+	NumChannels uint
+
+	// SampleRate is the stream output sample rate.
+	// The output format is always a stereo 16-bit signed LE PCM.
+	SampleRate uint
+
 	// MemoryUsage approximates the compiled XM module size in bytes.
-	// This can be important if you want to analyze linear interpolation (sub-samples)
-	// effect on your modules.
+	// This can be important if you want to analyze the interpolation mode
+	// effect on your modules (the precomputed sub-samples require extra memory).
 	MemoryUsage uint
 }
 
@@ -80,16 +151,23 @@ type StreamInfo struct {
 //
 // These extra configuration methods can be used even after a module is loaded.
 type LoadModuleConfig struct {
-	// LinearInterpolation enables sub-samples that will make some music sound smoother.
-	// On average, this option will make loaded track to require ~x2 memory.
+	// Interpolation selects the sample interpolation mode.
+	// Interpolation will make some music sound smoother.
 	//
-	// The best way to figure out whether you need it or not is to listen to the results.
+	// The best way to figure out which mode you need is to listen to the results.
 	// Most XM players you can find have linear interpolation (lerp) enabled by default.
+	// See InterpolationMode docs to learn the memory/CPU trade-offs of every mode.
 	//
-	// A zero value means "no interpolation".
+	// A zero value means "no interpolation" (unless LinearInterpolation is set).
 	//
 	// This should not be confused with volume ramping.
 	// The volume ramping is always enabled and can't be turned off.
+	Interpolation InterpolationMode
+
+	// LinearInterpolation is a legacy way to select InterpolationLinearPrecomputed.
+	// It's only taken into account if Interpolation is not set.
+	//
+	// Deprecated: use Interpolation instead.
 	LinearInterpolation bool
 
 	// BPM sets the playback speed.
@@ -120,14 +198,30 @@ type LoadModuleConfig struct {
 	// Therefore, you can only play XM tracks at sample rate of 44100.
 	// This limitation can go away later.
 	SampleRate uint
+
+	// MarkerEffect is an XM effect type that is reserved for the cue markers.
+	// Every time this effect is played, an EventMarker is emitted;
+	// the effect parameter is used as a marker payload.
+	// The marker effects don't affect the playback.
+	//
+	// Pick an effect type that is not used by the tracks otherwise.
+	// For example, 0x23 is displayed as "Z" in most trackers
+	// and it's unused in FastTracker II.
+	//
+	// A zero value disables the markers.
+	MarkerEffect uint8
 }
 
 // NewPlayer allocates a player that can load and play XM tracks.
 // Use LoadModule method to finish player initialization.
 func NewStream() *Stream {
 	return &Stream{
+		module:     &module{},
+		controller: &StreamController{},
 		settings: streamSettings{
-			volumeScaling: 0.8,
+			volumeScaling:   0.8,
+			speedMultiplier: 1,
+			pitchMultiplier: 1,
 		},
 	}
 }
@@ -139,16 +233,68 @@ func NewStream() *Stream {
 // Events are produced when the XM track is being played.
 // Therefore, calling Read() may produce multiple events.
 //
+// The handler is called from the goroutine that reads the stream
+// (for Ebitengine, it's the audio goroutine).
+// If you want to handle the events on another goroutine, consider
+// using SetEventQueue instead.
+//
 // Experimental: the events handling API may change significantly in the future.
 func (s *Stream) SetEventHandler(f func(e StreamEvent)) {
 	s.settings.eventHandler = f
+	s.updateEventsEnabled()
+}
+
+// SetEventQueue makes the stream push all its events into the queue.
+// A nil value removes the queue.
+//
+// The queue can be used along with the event handler (see SetEventHandler),
+// every event will be delivered to both of them.
+//
+// Experimental: the events handling API may change significantly in the future.
+func (s *Stream) SetEventQueue(q *EventQueue) {
+	s.settings.eventQueue = q
+	s.updateEventsEnabled()
+}
+
+func (s *Stream) updateEventsEnabled() {
+	s.settings.eventsEnabled = s.settings.eventHandler != nil || s.settings.eventQueue != nil
 }
 
 // SetVolume adjusts the global volume scaling for the stream.
 // The default value is 0.8; a value of 0 disables the sound.
 // The value is clamped in [0, 1].
+//
+// It cancels the active fade (if any), see FadeTo.
 func (s *Stream) SetVolume(v float64) {
 	s.settings.volumeScaling = clamp(v, 0, 1)
+	s.fade = streamFade{}
+}
+
+// SetSpeedMultiplier changes the playback speed without affecting the pitch.
+// It works by scaling the song BPM, so all tempo changes
+// inside the song are scaled as well.
+// The default value is 1; a value of 2 makes the song play twice as fast.
+// The value is clamped in [0.1, 10].
+//
+// It can be called in the middle of the playback, the change
+// takes effect on the next tick.
+// StreamEvent.Time values reflect the actual (scaled) playback time.
+func (s *Stream) SetSpeedMultiplier(v float64) {
+	s.settings.speedMultiplier = clamp(v, 0.1, 10)
+	if s.bpm != 0 {
+		s.setBPM(s.bpm)
+	}
+}
+
+// SetPitchShift changes the pitch of all notes without affecting the tempo.
+// The value is specified in semitones and it can be fractional.
+// The default value is 0; a value of 12 raises the pitch by one octave,
+// a value of -12 lowers it by one octave.
+//
+// It can be called in the middle of the playback, the change
+// takes effect on the next tick.
+func (s *Stream) SetPitchShift(semitones float64) {
+	s.settings.pitchMultiplier = math.Pow(2, semitones/12)
 }
 
 // SetLooping enables a simple looping from the beginning of the stream.
@@ -162,69 +308,181 @@ func (s *Stream) SetVolume(v float64) {
 //
 // Note: prefer this option to the InfiniteLoop provided by Ebitengine audio.
 // This native way of looping is ~free while InfiniteLoop has some overhead.
+//
+// Use SetLoopCount to limit the number of iterations.
+// Use SetLoopRange to loop only a part of the song.
 func (s *Stream) SetLooping(loop bool) {
 	s.settings.loop = loop
 }
 
-func (s *Stream) assignCompiledModule(m module) {
+// SetMaxDuration limits the stream playback duration (in seconds).
+// After the stream produced that much audio, Read returns EOF.
+// The looping is taken into account: the limit is applied to
+// the total playback time, not to a single song iteration.
+//
+// A value of 0 removes the limit (this is a default).
+//
+// This option is useful for the offline rendering of the looping streams.
+// See WriteTo method.
+func (s *Stream) SetMaxDuration(seconds float64) {
+	s.settings.maxDuration = clampMin(seconds, 0)
+}
+
+func (s *Stream) assignCompiledModule(m *module) {
 	s.module = m
 
+	// The loop range is bound to the module pattern order.
+	s.settings.loopRange = loopRange{}
+
+	// Instrument controls are reset to their defaults.
+	n := len(m.instruments)
+	if cap(s.settings.instrumentVolume) < n {
+		s.settings.instrumentVolume = make([]float64, n)
+	}
+	s.settings.instrumentVolume = s.settings.instrumentVolume[:n]
+	for i := range s.settings.instrumentVolume {
+		s.settings.instrumentVolume[i] = 1
+	}
+
 	// Call a rewind() that won't trigger a Sync event.
 	s.rewind()
 }
 
-// LoadModule assigns a new XM module to this stream.
+// SetModule assigns a compiled XM module to this stream.
+//
+// The same compiled module can be used by several streams at once.
+// Setting a module is cheap, it doesn't copy the module data.
+func (s *Stream) SetModule(m *CompiledModule) {
+	s.setNumChannels(m.data.numChannels)
+	s.assignCompiledModule(&m.data)
+}
+
+// LoadModule compiles the XM module and assigns it to this stream.
 //
 // Loading a module involves its compilation which is a slow process.
 // You want to load modules as rarely as possible (preferably exactly once)
 // and then play them via streams without ever releasing the memory.
+//
+// If you need to play the same module in several streams, use
+// Compile and SetModule instead to avoid the module data duplication.
 func (s *Stream) LoadModule(m *xmfile.Module, config LoadModuleConfig) error {
-	s.applyConfigDefaults(m, &config)
-
-	if config.SampleRate != 44100 {
-		return errors.New("unsupported sample rate (only 44100 is supported)")
+	compiled, err := Compile(m, config)
+	if err != nil {
+		return err
 	}
 
-	if cap(s.channels) < m.NumChannels {
-		s.channels = make([]streamChannel, m.NumChannels)
-		s.activeChannels = make([]*streamChannel, m.NumChannels)
+	s.SetModule(compiled)
+
+	return nil
+}
+
+func (s *Stream) setNumChannels(n int) {
+	if cap(s.channels) < n {
+		s.channels = make([]streamChannel, n)
+		s.activeChannels = make([]*streamChannel, n)
 	}
-	s.channels = s.channels[:m.NumChannels]
+	s.channels = s.channels[:n]
 	s.activeChannels = s.activeChannels[:0]
 
-	compiled, err := compileModule(m, moduleConfig{
-		sampleRate: config.SampleRate,
-		bpm:        config.BPM,
-		tempo:      config.Tempo,
-		subSamples: config.LinearInterpolation,
-	})
-	if err != nil {
-		return err
+	// Channel controls are reset to their defaults.
+	if cap(s.settings.channels) < n {
+		s.settings.channels = make([]channelSettings, n)
+	}
+	s.settings.channels = s.settings.channels[:n]
+	for i := range s.settings.channels {
+		s.settings.channels[i] = channelSettings{gain: 1, volume: 1}
 	}
+	s.settings.numSolo = 0
+}
 
-	s.assignCompiledModule(compiled)
+// SetChannelVolume adjusts the volume scaling for the specified channel.
+// The default value is 1; a value of 0 silences the channel.
+// The value is clamped in [0, 1].
+//
+// The channel controls take effect on the next tick and
+// they're smoothed by the volume ramping.
+// They're reset when a new module is assigned to the stream.
+//
+// ch is a module channel index, see StreamInfo.NumChannels.
+// An out of bounds channel index is ignored.
+func (s *Stream) SetChannelVolume(ch int, v float64) {
+	if !s.validChannel(ch) {
+		return
+	}
+	s.settings.channels[ch].volume = clamp(v, 0, 1)
+	s.updateChannelGains()
+}
 
-	return nil
+// SetChannelMuted mutes or unmutes the specified channel.
+// Unlike SetChannelVolume(ch, 0), it keeps the channel volume
+// value intact, so it's restored after unmuting.
+//
+// See SetChannelVolume for more info on channel controls.
+func (s *Stream) SetChannelMuted(ch int, muted bool) {
+	if !s.validChannel(ch) {
+		return
+	}
+	s.settings.channels[ch].muted = muted
+	s.updateChannelGains()
 }
 
-func (s *Stream) applyConfigDefaults(m *xmfile.Module, config *LoadModuleConfig) {
-	if config.SampleRate == 0 {
-		config.SampleRate = 44100
+// SetChannelSolo changes the specified channel solo state.
+// If any channel is in solo state, only solo channels are audible.
+//
+// See SetChannelVolume for more info on channel controls.
+func (s *Stream) SetChannelSolo(ch int, solo bool) {
+	if !s.validChannel(ch) {
+		return
 	}
-	if config.BPM == 0 {
-		config.BPM = uint(m.DefaultBPM)
-		if config.BPM == 0 {
-			config.BPM = 120
-		}
+	c := &s.settings.channels[ch]
+	if c.solo == solo {
+		return
+	}
+	c.solo = solo
+	if solo {
+		s.settings.numSolo++
+	} else {
+		s.settings.numSolo--
+	}
+	s.updateChannelGains()
+}
+
+// SetInstrumentVolume adjusts the volume scaling for the specified instrument.
+// It affects every channel that plays this instrument.
+// The default value is 1; a value of 0 silences the instrument.
+// The value is clamped in [0, 1].
+//
+// instID is a compiled instrument ID, the same value that is
+// reported by StreamEvent.NoteEventData.
+// An out of bounds instrument ID is ignored.
+//
+// Like channel controls, the instrument controls take effect on the next tick
+// and they're reset when a new module is assigned to the stream.
+func (s *Stream) SetInstrumentVolume(instID int, v float64) {
+	if instID < 0 || instID >= len(s.settings.instrumentVolume) {
+		return
 	}
-	if config.Tempo == 0 {
-		config.Tempo = uint(m.DefaultTempo)
-		if config.Tempo == 0 {
-			config.Tempo = 6
+	s.settings.instrumentVolume[instID] = clamp(v, 0, 1)
+}
+
+func (s *Stream) updateChannelGains() {
+	for i := range s.settings.channels {
+		c := &s.settings.channels[i]
+		switch {
+		case c.muted:
+			c.gain = 0
+		case s.settings.numSolo != 0 && !c.solo:
+			c.gain = 0
+		default:
+			c.gain = c.volume
 		}
 	}
 }
 
+func (s *Stream) validChannel(ch int) bool {
+	return ch >= 0 && ch < len(s.settings.channels)
+}
+
 // Seek partially implements io.Seeker.
 //
 // You can use it for two things:
@@ -249,72 +507,215 @@ func (s *Stream) Seek(offset int64, whence int) (int64, error) {
 
 // Read puts next PCM bytes into provided slice.
 //
-// The slice is expected to fit at least a single tick.
-// With BPM=120, Tempo=10 and SampleRate=44100 a single tick
-// would require 882*bytesPerSample*numChannels = 2208 bytes.
+// Read always fills the entire slice unless the stream has ended.
 // Note that this library only supports stereo output (numChannels=2)
 // and it produces 16-bit (2 bytes per sample) LE PCM data.
-// If you need to have precise info, use Stream.GetInfo() method.
 //
-// If there is a tail in b that was not written to due to the lack
-// of space for a whole tick, n<len(b) will be returned.
-// It doesn't make send to pass a slice that is smaller than a single
-// tick chunk (2k+ bytes), but it makes sense to pass a bigger slice
-// as this method will try to fit as many ticks as possible.
+// The stream is rendered tick by tick.
+// If there is not enough space in b to fit a whole tick, that tick
+// is rendered into the internal buffer; its leftovers will be
+// used during the next Read call.
+// Slices of any size work, but it's more efficient to use the
+// slices that can fit at least a single tick (2k+ bytes).
+// With BPM=120, Tempo=10 and SampleRate=44100 a single tick
+// would require 882*bytesPerSample*numChannels = 3528 bytes.
+// If you need to have precise info, use Stream.GetInfo() method.
 //
 // When stream has no bytes to produce, io.EOF error is returned.
 func (s *Stream) Read(b []byte) (int, error) {
 	written := 0
-	eof := false
+	limited := false
 
-	for len(b) > s.bytesPerTick {
-		if !s.nextTick() {
-			eof = true
-			break
-		}
-		s.readTick(b[:s.bytesPerTick])
+	// The commands are applied before the duration limit is checked:
+	// a Rewind command makes the stream that reached its limit playable again.
+	if s.controller.hasPending.Load() {
+		s.applyCommands()
+	}
 
-		written += s.bytesPerTick
-		b = b[s.bytesPerTick:]
+	if s.settings.maxDuration != 0 {
+		maxBytes := int(s.settings.maxDuration*s.module.sampleRate) * 4
+		remain := maxBytes - s.playedBytes
+		if remain <= 0 {
+			return 0, io.EOF
+		}
+		if len(b) > remain {
+			b = b[:remain]
+			limited = true
+		}
 	}
 
-	s.bytePos += written
+	for len(b) > 0 {
+		if len(s.tickPending) != 0 {
+			n := copy(b, s.tickPending)
+			s.tickPending = s.tickPending[n:]
+			s.bytePos += n
+			s.playedBytes += n
+			written += n
+			b = b[n:]
+			continue
+		}
 
-	if eof {
-		if s.settings.loop {
-			s.Rewind()
-			return written, nil
+		if s.controller.hasPending.Load() {
+			s.applyCommands()
+			// Some commands (like Restore) can make some bytes pending.
+			if len(s.tickPending) != 0 {
+				continue
+			}
+		}
+
+		if !s.nextTick() {
+			if !s.canLoopSong() {
+				s.endSong()
+				return written, io.EOF
+			}
+			s.rewindLoop()
+			continue
+		}
+
+		if len(b) >= s.bytesPerTick {
+			// The fast path: render the tick right into the destination.
+			s.renderTick(b[:s.bytesPerTick])
+			s.bytePos += s.bytesPerTick
+			s.playedBytes += s.bytesPerTick
+			written += s.bytesPerTick
+			b = b[s.bytesPerTick:]
+			continue
 		}
+
+		if cap(s.tickBuf) < s.bytesPerTick {
+			s.tickBuf = make([]byte, s.bytesPerTick)
+		}
+		s.tickPending = s.tickBuf[:s.bytesPerTick]
+		s.renderTick(s.tickPending)
+	}
+
+	if limited {
 		return written, io.EOF
 	}
 	return written, nil
 }
 
+// WriteTo implements io.WriterTo.
+//
+// It renders the entire stream into w using large internal chunks.
+// This is the most efficient way to render the song offline (e.g. into a WAV file).
+// io.Copy will use this method automatically.
+//
+// The looping settings are respected.
+// An infinitely looping stream must have a max duration set (see SetMaxDuration),
+// otherwise an error is returned as the stream would never end.
+func (s *Stream) WriteTo(w io.Writer) (int64, error) {
+	if s.isEndless() {
+		return 0, errors.New("can't render an endless stream (infinite looping is enabled, but max duration is not set)")
+	}
+
+	const chunkSize = 256 * 1024
+	buf := make([]byte, chunkSize)
+	total := int64(0)
+	for {
+		n, err := s.Read(buf)
+		if n != 0 {
+			written, writeErr := w.Write(buf[:n])
+			total += int64(written)
+			if writeErr != nil {
+				return total, writeErr
+			}
+			if written != n {
+				return total, io.ErrShortWrite
+			}
+		}
+		if err == io.EOF {
+			return total, nil
+		}
+	}
+}
+
+// isEndless reports whether the stream looping settings make it play forever.
+func (s *Stream) isEndless() bool {
+	if s.settings.maxDuration != 0 {
+		return false
+	}
+	if s.fade.stopped || (s.fade.active && s.fade.stop) {
+		return false
+	}
+	// The loop count is applied to the loop range if there is one.
+	// The song looping is infinite in this case.
+	if s.settings.loopRange.active {
+		return s.settings.loop || s.settings.loopCount == 0
+	}
+	return s.settings.loop && s.settings.loopCount == 0
+}
+
+func (s *Stream) renderTick(dst []byte) {
+	if s.settings.meter != nil {
+		s.readTickMetered(dst)
+	} else {
+		s.readTick(dst)
+	}
+	if len(s.settings.processors) != 0 {
+		s.applyProcessors(dst)
+	}
+	if s.settings.spectrum != nil {
+		s.settings.spectrum.analyze(dst)
+	}
+	s.t += s.secondsPerTick
+}
+
 // Rewind prepares the stream to play the module right from the start.
 // Doing rewind is relatively cheap.
+//
+// Rewind cancels the active fade (if any), the volume is left as is.
 func (s *Stream) Rewind() {
-	if s.settings.eventHandler != nil {
-		s.settings.eventHandler(StreamEvent{
-			Kind:  EventSync,
-			Time:  s.t,
-			value: math.Float64bits(0),
-		})
+	if s.settings.eventsEnabled {
+		s.emitEvent(EventSync, 0, math.Float64bits(0))
 	}
 	s.rewind()
 }
 
-func (s *Stream) rewind() {
-	// Make all fields zero-initialized just to be safe.
-	// Copying the module object is redundant, but oh well (it's a shallow copy anyway).
-	*s = Stream{
-		module:         s.module,
-		channels:       s.channels,
-		activeChannels: s.activeChannels,
-		settings:       s.settings,
+// rewindLoop prepares the stream for the next loop iteration.
+// Unlike Rewind, it preserves the total playback counters.
+func (s *Stream) rewindLoop() {
+	playedBytes := s.playedBytes
+	queuedJump := s.queuedJump
+	fade := s.fade
+	songLoopsDone := s.songLoopsDone + 1
+	if s.settings.eventsEnabled {
+		s.emitEvent(EventLoop, 0, uint64(songLoopsDone)|(1<<32))
+	}
+	s.Rewind()
+	s.playedBytes = playedBytes
+	s.queuedJump = queuedJump
+	s.fade = fade
+	s.songLoopsDone = songLoopsDone
+}
+
+func (s *Stream) canLoopSong() bool {
+	// An empty song can't be looped: it has no patterns to play.
+	// A faded out stream is stopped even if it's looping.
+	if !s.settings.loop || s.patternIndex == -1 || s.fade.stopped {
+		return false
+	}
+	// With a loop range, the loop count is applied to the range instead.
+	return s.settings.loopRange.active || s.canLoop(s.songLoopsDone)
+}
+
+func (s *Stream) endSong() {
+	if s.songEnded {
+		return
+	}
+	s.songEnded = true
+	if s.settings.eventsEnabled {
+		s.emitEvent(EventSongEnd, 0, 0)
 	}
+}
 
-	// Now initialize the player to the "ready to start" state.
+func (s *Stream) rewind() {
+	// Initialize the player to the "ready to start" state.
 	// This code is used as a final part of the constructor as well.
+	//
+	// Only the playback state is reset here.
+	// The settings and the controller are never re-assigned:
+	// they're accessed by other goroutines (see Controller and ChannelLevels).
 
 	for i := range s.channels {
 		ch := &s.channels[i]
@@ -322,26 +723,45 @@ func (s *Stream) rewind() {
 		ch.id = i
 	}
 
-	s.globalVolume = 1.0
+	s.pattern = nil
 	s.patternIndex = -1
 	s.patternRowsRemain = 0
 	s.patternRowIndex = -1
 	s.rowTicksRemain = 0
 	s.tickIndex = -1
 
-	s.ticksPerRow = s.module.ticksPerRow
+	s.jumpKind = jumpNone
+	s.jumpPattern = 0
+	s.jumpRow = 0
+	s.queuedJump = queuedJump{}
+	s.rangeLoopsDone = 0
+	s.songLoopsDone = 0
+	s.songEnded = false
+	s.fade = streamFade{}
+
+	s.globalVolume = 1.0
+	s.bytePos = 0
+	s.playedBytes = 0
+	s.t = 0
+	s.tickPending = nil
+
+	s.setTempo(s.module.ticksPerRow)
 	s.setBPM(s.module.bpm)
 }
 
+// setTempo changes the stream playback tempo.
+// The module defaults are never modified here: they're only used by rewind().
 func (s *Stream) setTempo(tempo int) {
-	s.module.ticksPerRow = tempo
-	s.secondsPerRow = calcSecondsPerRow(s.module.ticksPerRow, s.bpm)
+	s.ticksPerRow = tempo
 }
 
 func (s *Stream) setBPM(bpm float64) {
 	s.bpm = bpm
-	s.samplesPerTick, s.bytesPerTick = calcSamplesPerTick(s.module.sampleRate, s.bpm)
-	s.secondsPerRow = calcSecondsPerRow(s.module.ticksPerRow, s.bpm)
+	// The speed multiplier only affects the tick length,
+	// the song BPM value is kept as is.
+	effectiveBPM := s.bpm * s.settings.speedMultiplier
+	s.samplesPerTick, s.bytesPerTick = calcSamplesPerTick(s.module.sampleRate, effectiveBPM)
+	s.secondsPerTick = 1 / ticksPerSecond(effectiveBPM)
 }
 
 // GetInfo returns stream-related info.
@@ -349,11 +769,17 @@ func (s *Stream) setBPM(bpm float64) {
 func (s *Stream) GetInfo() StreamInfo {
 	return StreamInfo{
 		BytesPerTick: uint(s.bytesPerTick),
-		MemoryUsage:  moduleSize(&s.module),
+		NumChannels:  uint(len(s.channels)),
+		SampleRate:   uint(s.module.sampleRate),
+		MemoryUsage:  moduleSize(s.module),
 	}
 }
 
 func (s *Stream) nextTick() bool {
+	if s.fade.stopped {
+		return false
+	}
+
 	if s.rowTicksRemain == 0 {
 		if !s.nextRow() {
 			return false
@@ -363,6 +789,10 @@ func (s *Stream) nextTick() bool {
 	s.rowTicksRemain--
 	s.tickIndex++
 
+	if s.fade.active {
+		s.tickFade()
+	}
+
 	s.activeChannels = s.activeChannels[:0]
 	baseVolume := s.settings.volumeScaling * s.globalVolume
 	for j := range s.channels {
@@ -373,8 +803,13 @@ func (s *Stream) nextTick() bool {
 
 		panning := ch.panning + (ch.panningEnvelope.value-0.5)*(0.5-abs(ch.panning-0.5))*2
 
+		chVolume := ch.volume
+		if ch.inst != nil && ch.inst.id != -1 {
+			chVolume *= s.settings.instrumentVolume[ch.inst.id]
+		}
+
 		// 0.25 is an amplification heuristic to avoid clipping.
-		volume := 0.25 * baseVolume * ch.volume * ch.fadeoutVolume * ch.volumeEnvelope.value
+		volume := 0.25 * baseVolume * s.settings.channels[j].gain * chVolume * ch.fadeoutVolume * ch.volumeEnvelope.value
 		ch.targetVolume[0] = volume * math.Sqrt(1.0-panning)
 		ch.targetVolume[1] = volume * math.Sqrt(panning)
 
@@ -392,7 +827,7 @@ func (s *Stream) nextTick() bool {
 		}
 
 		freq := linearFrequency(ch.period - (64 * ch.arpeggioNoteOffset) - (16 * ch.vibratoPeriodOffset))
-		ch.sampleStep = freq / s.module.sampleRate
+		ch.sampleStep = (freq / s.module.sampleRate) * s.settings.pitchMultiplier
 		if ch.inst != nil {
 			ch.sampleStep *= ch.inst.sampleStepMultiplier
 		}
@@ -449,6 +884,21 @@ func (s *Stream) envelopeTick(ch *streamChannel, e *envelopeRunner) {
 }
 
 func (s *Stream) nextRow() bool {
+	prevPatternIndex := s.patternIndex
+
+	if s.queuedJump.active && s.queuedJumpReady() {
+		s.queuedJump.active = false
+		s.jumpKind = jumpQueued
+		s.jumpPattern = s.queuedJump.order
+		s.jumpRow = s.queuedJump.row
+	} else if s.settings.loopRange.active && s.loopRangeEnd() && s.canLoop(s.rangeLoopsDone) {
+		// The loop range end overrides the pattern break effects.
+		s.rangeLoopsDone++
+		s.jumpKind = jumpLoop
+		s.jumpPattern = s.settings.loopRange.startOrder
+		s.jumpRow = s.settings.loopRange.startRow
+	}
+
 	if s.jumpKind == jumpNone {
 		// Normal execution.
 		if s.patternRowsRemain == 0 {
@@ -460,26 +910,56 @@ func (s *Stream) nextRow() bool {
 		s.patternRowsRemain--
 	} else {
 		// Execute a pattern jump.
+		if s.jumpPattern >= len(s.module.patternOrder) {
+			// A pattern break on the last pattern ends the song.
+			// Keep the jump state as is, so the next call would fail too.
+			return false
+		}
+		if s.settings.eventsEnabled {
+			switch s.jumpKind {
+			case jumpQueued:
+				s.emitEvent(EventJump, 0, uint64(s.jumpPattern)|(uint64(s.jumpRow)<<16))
+			case jumpLoop:
+				s.emitEvent(EventLoop, 0, uint64(s.rangeLoopsDone))
+			}
+		}
 		s.jumpKind = jumpNone
 		s.selectPattern(s.jumpPattern)
 		s.patternRowIndex = s.jumpRow
+		if s.patternRowIndex >= s.pattern.numRows {
+			s.patternRowIndex = 0
+		}
 		s.patternRowsRemain = s.pattern.numRows - s.patternRowIndex - 1
 	}
 
+	if s.settings.eventsEnabled {
+		s.emitRowEvents(prevPatternIndex != s.patternIndex)
+	}
+
 	noteOffset := s.pattern.numChannels * s.patternRowIndex
 	notes := s.pattern.notes[noteOffset : noteOffset+s.pattern.numChannels]
-	m := &s.module
+	m := s.module
 
 	for i := range s.channels {
 		s.advanceChannelRow(&s.channels[i], &m.noteTab[notes[i]])
 	}
 
-	s.t += s.secondsPerRow
 	s.rowTicksRemain = s.ticksPerRow
 	s.tickIndex = -1
 	return true
 }
 
+func (s *Stream) emitRowEvents(orderChanged bool) {
+	value := uint64(s.patternIndex) | (uint64(s.pattern.id) << 16) | (uint64(s.patternRowIndex) << 32)
+	if orderChanged {
+		s.emitEvent(EventOrderChange, 0, value)
+	}
+	if s.patternRowIndex == 0 {
+		s.emitEvent(EventPatternStart, 0, value)
+	}
+	s.emitEvent(EventRow, 0, value)
+}
+
 func (s *Stream) advanceChannelRow(ch *streamChannel, n *patternNote) {
 	ch.assignNote(n)
 
@@ -487,18 +967,35 @@ func (s *Stream) advanceChannelRow(ch *streamChannel, n *patternNote) {
 		s.applyRowEffect(ch, n)
 	}
 
-	if s.settings.eventHandler != nil && n.raw != 0 {
+	// A key-off note is reported as EventNoteOff.
+	if s.settings.eventsEnabled && n.raw != 0 && n.raw != keyOffNote {
 		instID := 255 // It's a sentinel value that fits 8 bits
 		if ch.inst != nil {
 			instID = ch.inst.id
 		}
 		value := uint64(n.raw) | uint64(instID<<8) | (uint64(math.Float32bits(float32(ch.volume))) << 16)
-		s.settings.eventHandler(StreamEvent{
-			Kind:    EventNote,
-			Channel: ch.id,
-			Time:    s.t,
-			value:   value,
-		})
+		s.emitEvent(EventNote, ch.id, value)
+	}
+}
+
+// emitEvent sends the event to the handler and the queue.
+// The caller is expected to check whether the events are enabled
+// before computing the event value.
+func (s *Stream) emitEvent(kind StreamEventKind, channel int, value uint64) {
+	e := StreamEvent{
+		Kind:    kind,
+		Channel: channel,
+		Time:    s.t,
+		// The events are emitted before the current tick is rendered,
+		// so the rendered bytes count is the tick start offset.
+		SampleOffset: int64(s.playedBytes+len(s.tickPending)) / 4,
+		value:        value,
+	}
+	if s.settings.eventQueue != nil {
+		s.settings.eventQueue.push(e)
+	}
+	if s.settings.eventHandler != nil {
+		s.settings.eventHandler(e)
 	}
 }
 
@@ -506,12 +1003,24 @@ func (s *Stream) applyRowEffect(ch *streamChannel, n *patternNote) {
 	numEffects := ch.effect.Len()
 	offset := ch.effect.Index()
 	for _, e := range s.module.effectTab[offset : offset+numEffects] {
+		if s.settings.eventsEnabled {
+			s.emitEvent(EventEffect, ch.id, uint64(e.op)|(uint64(e.rawValue)<<32))
+		}
+
 		switch e.op {
 		case xmdb.EffectSetVolume:
 			ch.volume = e.floatValue
 
 		case xmdb.EffectEarlyKeyOff:
 			s.keyOff(ch)
+			if s.settings.eventsEnabled {
+				s.emitEvent(EventNoteOff, ch.id, 0)
+			}
+
+		case xmdb.EffectMarker:
+			if s.settings.eventsEnabled {
+				s.emitEvent(EventMarker, ch.id, uint64(e.rawValue))
+			}
 
 		case xmdb.EffectVolumeSlide, xmdb.EffectVibratoWithVolumeSlide:
 			if e.floatValue != 0 {
@@ -575,7 +1084,7 @@ func (s *Stream) applyRowEffect(ch *streamChannel, n *patternNote) {
 			s.setBPM(e.floatValue)
 
 		case xmdb.EffectSetTempo:
-			s.ticksPerRow = int(e.rawValue)
+			s.setTempo(int(e.rawValue))
 
 		case xmdb.EffectFineVolumeSlideDown:
 			ch.volume = clampMin(ch.volume-e.floatValue, 0)
@@ -666,6 +1175,9 @@ func (s *Stream) applyTickEffect(ch *streamChannel) {
 				break
 			}
 			s.keyOff(ch)
+			if s.settings.eventsEnabled {
+				s.emitEvent(EventNoteOff, ch.id, 0)
+			}
 
 		case xmdb.EffectSetEnvelopePos:
 			ch.volumeEnvelope.frame = int(e.rawValue)
@@ -675,6 +1187,9 @@ func (s *Stream) applyTickEffect(ch *streamChannel) {
 				break
 			}
 			ch.volume = 0
+			if s.settings.eventsEnabled {
+				s.emitEvent(EventNoteOff, ch.id, 1)
+			}
 
 		case xmdb.EffectArpeggio:
 			i := s.tickIndex % 3
@@ -155,7 +155,18 @@ func (ch *streamChannel) NextSample() int16 {
 		return 0
 	}
 
-	v := ch.inst.samples[sampleOffset]
+	var v int16
+	switch ch.inst.interpolation {
+	case InterpolationLinear:
+		v = ch.linearSample(sampleOffset)
+	case InterpolationCubic:
+		v = ch.cubicSample(sampleOffset)
+	case InterpolationSinc:
+		v = ch.sincSample(sampleOffset)
+	default:
+		// No interpolation or the precomputed sub-samples.
+		v = ch.inst.samples[sampleOffset]
+	}
 
 	ch.sampleOffset += ch.sampleStep
 	if ch.sampleOffset >= ch.inst.loopEnd {
@@ -0,0 +1,273 @@
+package xm
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// StreamController is a concurrency-safe way to control a Stream.
+// Use Stream.Controller to get it.
+//
+// A typical setup is to have the stream read by the audio goroutine
+// (e.g. Ebitengine audio player), while the game logic wants to change the
+// playback settings from the update loop. Calling the Stream methods
+// directly in this case is a data race.
+//
+// The controller methods record the commands and return immediately.
+// The commands are applied by the stream during the next Read call,
+// at the tick boundary, in the order they were issued.
+// Recording a command doesn't allocate (unless the command buffer needs to grow).
+//
+// Since the commands are applied asynchronously, the methods that could
+// fail (like QueueJump) don't report errors: invalid commands are ignored.
+// Validate the arguments in advance if needed.
+type StreamController struct {
+	mu sync.Mutex
+
+	// The commands are double-buffered: the controller
+	// appends to pending, while the stream applies the other buffer.
+	pending []streamCommand
+	applied []streamCommand
+
+	hasPending atomic.Bool
+}
+
+type streamCommandKind uint8
+
+const (
+	cmdSetVolume streamCommandKind = iota
+	cmdFadeTo
+	cmdFadeOut
+	cmdSetLooping
+	cmdSetLoopCount
+	cmdSetLoopRange
+	cmdClearLoopRange
+	cmdSetSpeedMultiplier
+	cmdSetPitchShift
+	cmdSetChannelVolume
+	cmdSetChannelMuted
+	cmdSetChannelSolo
+	cmdSetInstrumentVolume
+	cmdQueueJump
+	cmdCancelQueuedJump
+	cmdRewind
+	cmdSetModule
+	cmdRestore
+	cmdSetProcessors
+	cmdSnapshot
+)
+
+// streamCommand is a union-like command representation.
+// The fields meaning depends on the command kind.
+type streamCommand struct {
+	kind streamCommandKind
+	flag bool
+	ints [4]int
+	f1   float64
+	f2   float64
+
+	module       *CompiledModule
+	snapshot     *StreamSnapshot
+	processors   []Processor
+	snapshotFunc func(snapshot *StreamSnapshot)
+}
+
+// Controller returns the stream controller.
+// The same controller is returned for every call.
+//
+// The following Stream methods are concurrency-safe, they can be called while
+// another goroutine is inside Read:
+//   - Controller (and all StreamController methods)
+//   - ChannelLevels, ChannelPeaks, ChannelScope
+//   - SpectrumBands
+//
+// The EventQueue consumer methods can also be used on another goroutine.
+// All other methods should not be called concurrently with Read.
+func (s *Stream) Controller() *StreamController {
+	return s.controller
+}
+
+// SetVolume is a concurrency-safe version of Stream.SetVolume.
+func (c *StreamController) SetVolume(v float64) {
+	c.push(streamCommand{kind: cmdSetVolume, f1: v})
+}
+
+// FadeTo is a concurrency-safe version of Stream.FadeTo.
+func (c *StreamController) FadeTo(volume, seconds float64) {
+	c.push(streamCommand{kind: cmdFadeTo, f1: volume, f2: seconds})
+}
+
+// FadeOut is a concurrency-safe version of Stream.FadeOut.
+func (c *StreamController) FadeOut(seconds float64) {
+	c.push(streamCommand{kind: cmdFadeOut, f1: seconds})
+}
+
+// SetLooping is a concurrency-safe version of Stream.SetLooping.
+func (c *StreamController) SetLooping(loop bool) {
+	c.push(streamCommand{kind: cmdSetLooping, flag: loop})
+}
+
+// SetLoopCount is a concurrency-safe version of Stream.SetLoopCount.
+func (c *StreamController) SetLoopCount(n int) {
+	c.push(streamCommand{kind: cmdSetLoopCount, ints: [4]int{n}})
+}
+
+// SetLoopRange is a concurrency-safe version of Stream.SetLoopRange.
+// An invalid loop range is ignored.
+func (c *StreamController) SetLoopRange(startOrder, startRow, endOrder, endRow int) {
+	c.push(streamCommand{kind: cmdSetLoopRange, ints: [4]int{startOrder, startRow, endOrder, endRow}})
+}
+
+// ClearLoopRange is a concurrency-safe version of Stream.ClearLoopRange.
+func (c *StreamController) ClearLoopRange() {
+	c.push(streamCommand{kind: cmdClearLoopRange})
+}
+
+// SetSpeedMultiplier is a concurrency-safe version of Stream.SetSpeedMultiplier.
+func (c *StreamController) SetSpeedMultiplier(v float64) {
+	c.push(streamCommand{kind: cmdSetSpeedMultiplier, f1: v})
+}
+
+// SetPitchShift is a concurrency-safe version of Stream.SetPitchShift.
+func (c *StreamController) SetPitchShift(semitones float64) {
+	c.push(streamCommand{kind: cmdSetPitchShift, f1: semitones})
+}
+
+// SetChannelVolume is a concurrency-safe version of Stream.SetChannelVolume.
+// An out of bounds channel index is ignored.
+func (c *StreamController) SetChannelVolume(ch int, v float64) {
+	c.push(streamCommand{kind: cmdSetChannelVolume, ints: [4]int{ch}, f1: v})
+}
+
+// SetChannelMuted is a concurrency-safe version of Stream.SetChannelMuted.
+// An out of bounds channel index is ignored.
+func (c *StreamController) SetChannelMuted(ch int, muted bool) {
+	c.push(streamCommand{kind: cmdSetChannelMuted, ints: [4]int{ch}, flag: muted})
+}
+
+// SetChannelSolo is a concurrency-safe version of Stream.SetChannelSolo.
+// An out of bounds channel index is ignored.
+func (c *StreamController) SetChannelSolo(ch int, solo bool) {
+	c.push(streamCommand{kind: cmdSetChannelSolo, ints: [4]int{ch}, flag: solo})
+}
+
+// SetInstrumentVolume is a concurrency-safe version of Stream.SetInstrumentVolume.
+// An out of bounds instrument index is ignored.
+func (c *StreamController) SetInstrumentVolume(inst int, v float64) {
+	c.push(streamCommand{kind: cmdSetInstrumentVolume, ints: [4]int{inst}, f1: v})
+}
+
+// QueueJump is a concurrency-safe version of Stream.QueueJump.
+// An invalid jump is ignored.
+func (c *StreamController) QueueJump(order, row int, when JumpTiming) {
+	c.push(streamCommand{kind: cmdQueueJump, ints: [4]int{order, row, int(when.Kind), when.BeatRows}})
+}
+
+// CancelQueuedJump is a concurrency-safe version of Stream.CancelQueuedJump.
+func (c *StreamController) CancelQueuedJump() {
+	c.push(streamCommand{kind: cmdCancelQueuedJump})
+}
+
+// Rewind is a concurrency-safe version of Stream.Rewind.
+func (c *StreamController) Rewind() {
+	c.push(streamCommand{kind: cmdRewind})
+}
+
+// SetModule is a concurrency-safe version of Stream.SetModule.
+func (c *StreamController) SetModule(m *CompiledModule) {
+	c.push(streamCommand{kind: cmdSetModule, module: m})
+}
+
+// Restore is a concurrency-safe version of Stream.Restore.
+// An incompatible snapshot is ignored.
+func (c *StreamController) Restore(snapshot *StreamSnapshot) {
+	c.push(streamCommand{kind: cmdRestore, snapshot: snapshot})
+}
+
+// SetProcessors is a concurrency-safe version of Stream.SetProcessors.
+func (c *StreamController) SetProcessors(processors ...Processor) {
+	c.push(streamCommand{kind: cmdSetProcessors, processors: processors})
+}
+
+// Snapshot is a concurrency-safe version of Stream.Snapshot.
+//
+// The snapshot is captured when the stream applies this command,
+// it's passed to f on the goroutine that reads the stream.
+// f should not block; it can send the snapshot over a buffered channel, for instance.
+func (c *StreamController) Snapshot(f func(snapshot *StreamSnapshot)) {
+	c.push(streamCommand{kind: cmdSnapshot, snapshotFunc: f})
+}
+
+func (c *StreamController) push(cmd streamCommand) {
+	c.mu.Lock()
+	c.pending = append(c.pending, cmd)
+	c.hasPending.Store(true)
+	c.mu.Unlock()
+}
+
+// applyCommands executes the pending controller commands.
+// It's called by the stream at the tick boundary.
+func (s *Stream) applyCommands() {
+	c := s.controller
+
+	c.mu.Lock()
+	c.pending, c.applied = c.applied[:0], c.pending
+	c.hasPending.Store(false)
+	c.mu.Unlock()
+
+	for i := range c.applied {
+		cmd := &c.applied[i]
+		s.applyCommand(cmd)
+		// Don't keep the module and snapshot alive longer than needed.
+		cmd.module = nil
+		cmd.snapshot = nil
+		cmd.processors = nil
+		cmd.snapshotFunc = nil
+	}
+}
+
+func (s *Stream) applyCommand(cmd *streamCommand) {
+	switch cmd.kind {
+	case cmdSetVolume:
+		s.SetVolume(cmd.f1)
+	case cmdFadeTo:
+		s.FadeTo(cmd.f1, cmd.f2)
+	case cmdFadeOut:
+		s.FadeOut(cmd.f1)
+	case cmdSetLooping:
+		s.SetLooping(cmd.flag)
+	case cmdSetLoopCount:
+		s.SetLoopCount(cmd.ints[0])
+	case cmdSetLoopRange:
+		_ = s.SetLoopRange(cmd.ints[0], cmd.ints[1], cmd.ints[2], cmd.ints[3])
+	case cmdClearLoopRange:
+		s.ClearLoopRange()
+	case cmdSetSpeedMultiplier:
+		s.SetSpeedMultiplier(cmd.f1)
+	case cmdSetPitchShift:
+		s.SetPitchShift(cmd.f1)
+	case cmdSetChannelVolume:
+		s.SetChannelVolume(cmd.ints[0], cmd.f1)
+	case cmdSetChannelMuted:
+		s.SetChannelMuted(cmd.ints[0], cmd.flag)
+	case cmdSetChannelSolo:
+		s.SetChannelSolo(cmd.ints[0], cmd.flag)
+	case cmdSetInstrumentVolume:
+		s.SetInstrumentVolume(cmd.ints[0], cmd.f1)
+	case cmdQueueJump:
+		when := JumpTiming{Kind: JumpTimingKind(cmd.ints[2]), BeatRows: cmd.ints[3]}
+		_ = s.QueueJump(cmd.ints[0], cmd.ints[1], when)
+	case cmdCancelQueuedJump:
+		s.CancelQueuedJump()
+	case cmdRewind:
+		s.Rewind()
+	case cmdSetModule:
+		s.SetModule(cmd.module)
+	case cmdRestore:
+		_ = s.Restore(cmd.snapshot)
+	case cmdSetProcessors:
+		s.SetProcessors(cmd.processors...)
+	case cmdSnapshot:
+		cmd.snapshotFunc(s.Snapshot())
+	}
+}
@@ -0,0 +1,107 @@
+package xm
+
+import (
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestStreamControllerConcurrentUse(t *testing.T) {
+	s := newTestStream(t)
+	s.SetLooping(true)
+	s.SetSpeedMultiplier(4)
+	s.EnableMetering(true)
+	s.SetChannelScopeSize(64)
+	s.EnableSpectrum(8)
+	queue := NewEventQueue(256)
+	s.SetEventQueue(queue)
+
+	var numReads atomic.Int64
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		// This goroutine acts like an audio player.
+		// The stream loops, so it's rewound every now and then.
+		// It keeps reading until the game loop is done.
+		defer wg.Done()
+		buf := make([]byte, 8192)
+		for !stop.Load() {
+			if _, err := s.Read(buf); err != nil {
+				t.Errorf("read: %v", err)
+				stop.Store(true)
+				return
+			}
+			numReads.Add(1)
+		}
+	}()
+
+	// This loop acts like a game loop.
+	// The metering results are polled all the time,
+	// while the commands are issued only occasionally.
+	// It runs until there were enough reads and at least one snapshot was received.
+	var snapshot *StreamSnapshot
+	snapshots := make(chan *StreamSnapshot, 1)
+	levels := make([]float32, 2)
+	bands := make([]float32, 8)
+	var events []StreamEvent
+	for i := 0; (numReads.Load() < 200 || snapshot == nil) && !stop.Load(); i++ {
+		s.ChannelLevels(levels)
+		s.ChannelPeaks(levels)
+		s.ChannelScope(0, levels)
+		s.SpectrumBands(bands)
+		events = queue.Drain(events[:0])
+		c := s.Controller()
+		switch i % 10 {
+		case 1:
+			c.SetVolume(0.5)
+			c.SetChannelMuted(0, i%20 == 1)
+		case 5:
+			c.Rewind()
+		case 9:
+			c.Snapshot(func(snapshot *StreamSnapshot) {
+				select {
+				case snapshots <- snapshot:
+				default:
+				}
+			})
+		}
+		select {
+		case snapshot = <-snapshots:
+		default:
+		}
+		runtime.Gosched()
+	}
+	stop.Store(true)
+	wg.Wait()
+
+	if snapshot == nil {
+		t.Fatal("the snapshot command was not executed")
+	}
+	if err := s.Restore(snapshot); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+}
+
+func TestStreamControllerRewindAfterMaxDuration(t *testing.T) {
+	s := newTestStream(t)
+	s.SetMaxDuration(0.1)
+
+	if _, err := io.Copy(io.Discard, s); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Read(make([]byte, 4)); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+
+	s.Controller().Rewind()
+	n, err := io.Copy(io.Discard, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(4410 * 4); n != want {
+		t.Fatalf("written bytes mismatch after rewind:\nhave %d\nwant %d", n, want)
+	}
+}
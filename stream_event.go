@@ -36,6 +36,98 @@ const (
 	//
 	// Experimental: the events handling API may change significantly in the future.
 	EventSync
+
+	// EventJump is emitted when a jump scheduled by Stream.QueueJump is executed.
+	// The event Time is the start time of the jump target row.
+	//
+	// Use StreamEvent.JumpEventData to get the event data.
+	//
+	// Experimental: the events handling API may change significantly in the future.
+	EventJump
+
+	// EventLoop is emitted when the playback wraps to the loop range start
+	// or when a looping stream wraps to the song start.
+	// See Stream.SetLoopRange and Stream.SetLooping.
+	//
+	// For the loop range, the event Time is the start time of the loop start row.
+	// For the whole song loop, the event Time is the song end time;
+	// it's followed by EventSync that resets the time to 0.
+	// This way it's possible to distinguish the looping from a user-triggered Rewind.
+	//
+	// Use StreamEvent.LoopEventData to get the event data.
+	//
+	// Experimental: the events handling API may change significantly in the future.
+	EventLoop
+
+	// EventRow is emitted every time a new pattern row starts playing.
+	// It's emitted even for the rows without any notes,
+	// so it can be used to track the song beats.
+	// This event is emitted before any EventNote of this row.
+	//
+	// Use StreamEvent.RowEventData to get the event data.
+	//
+	// Experimental: the events handling API may change significantly in the future.
+	EventRow
+
+	// EventPatternStart is emitted when a pattern starts playing from its first row.
+	// This includes the jumps to the first row of a pattern.
+	// This event is emitted right before the EventRow of that row.
+	//
+	// Use StreamEvent.RowEventData to get the event data.
+	//
+	// Experimental: the events handling API may change significantly in the future.
+	EventPatternStart
+
+	// EventOrderChange is emitted when the playback moves to another pattern order entry.
+	// This includes the jumps, even if the jump target is a row in the middle of a pattern.
+	// This event is emitted before the EventPatternStart and EventRow of the new position.
+	//
+	// Use StreamEvent.RowEventData to get the event data.
+	//
+	// Experimental: the events handling API may change significantly in the future.
+	EventOrderChange
+
+	// EventSongEnd is emitted when the stream reaches its end and Read is about to return EOF.
+	// This event is not emitted for the looping streams, unless the loop count limit is reached.
+	// It's also emitted when the stream is stopped by Stream.FadeOut.
+	// The event Time is the song end time.
+	//
+	// This event is emitted only once, until the stream is rewound.
+	// The SetMaxDuration limit doesn't trigger this event.
+	//
+	// Experimental: the events handling API may change significantly in the future.
+	EventSongEnd
+
+	// EventMarker is emitted when a cue marker effect is played.
+	// The marker effect type is configured by LoadModuleConfig.MarkerEffect.
+	// It has the same Time semantics as EventNote.
+	//
+	// Use StreamEvent.MarkerEventData to get the event data.
+	//
+	// Experimental: the events handling API may change significantly in the future.
+	EventMarker
+
+	// EventNoteOff is emitted when a channel note is released or cut.
+	// This includes the key-off notes and the key-off (Kxx) and note cut (ECx) effects.
+	// A key-off note doesn't trigger an EventNote.
+	//
+	// The row-level key-offs have the row start Time;
+	// the tick-level effects have the Time of the tick they're executed at.
+	//
+	// Use StreamEvent.NoteOffEventData to get the event data.
+	//
+	// Experimental: the events handling API may change significantly in the future.
+	EventNoteOff
+
+	// EventEffect is emitted for every effect of a row, per channel.
+	// This includes the volume column effects.
+	// It has the same Time semantics as EventNote and it's emitted before
+	// the EventNote of the same row and channel.
+	//
+	// Use StreamEvent.EffectEventData to get the event data.
+	//
+	// Experimental: the events handling API may change significantly in the future.
+	EventEffect
 )
 
 // StreamEvent holds a single Stream event data.
@@ -62,11 +154,30 @@ type StreamEvent struct {
 
 	// Time represents the playback offset in seconds.
 	// Time=2.5 means that this event happened somewhere around 2.5 seconds.
+	//
+	// The row-level events (like EventNote) have a Time value of the row start.
+	// The events of the first row have Time=0.
+	// Tempo and BPM changes (Fxx effect) are taken into account.
 	Time float64
 
+	// SampleOffset is a position in the output PCM stream where this event becomes audible.
+	// It's measured in frames (a frame is a pair of stereo samples, 4 bytes).
+	// Unlike Time, it's exact: it doesn't accumulate any rounding errors.
+	//
+	// The offset is counted from the stream start (or from the last Stream.Rewind call).
+	// It's not reset by the looping, so it matches the audio player position.
+	// Use ByteOffset to get the same value in bytes.
+	SampleOffset int64
+
 	value uint64
 }
 
+// ByteOffset returns the SampleOffset value in bytes.
+// It can be compared with the number of bytes read from the stream.
+func (e StreamEvent) ByteOffset() int64 {
+	return e.SampleOffset * 4
+}
+
 // NoteEventData returns the event data if e.Kind=EventSync.
 // The return values are: note, instrument (id), volume.
 // If there is no instrument, -1 is returned.
@@ -86,3 +197,44 @@ func (e StreamEvent) NoteEventData() (note, instrument int, vol float32) {
 func (e StreamEvent) SyncEventData() (t float64) {
 	return math.Float64frombits(e.value)
 }
+
+// JumpEventData returns the event data if e.Kind=EventJump.
+// The return values are: the pattern order index and the row of the jump target.
+func (e StreamEvent) JumpEventData() (order, row int) {
+	return int(e.value & 0xffff), int((e.value >> 16) & 0xffff)
+}
+
+// RowEventData returns the event data if e.Kind is EventRow, EventPatternStart or EventOrderChange.
+// The return values are: the pattern order index, the pattern index (as in XM file) and the row.
+func (e StreamEvent) RowEventData() (order, pattern, row int) {
+	return int(e.value & 0xffff), int((e.value >> 16) & 0xffff), int((e.value >> 32) & 0xffff)
+}
+
+// MarkerEventData returns the event data if e.Kind=EventMarker.
+// The return values are: the marker effect parameter.
+func (e StreamEvent) MarkerEventData() (value int) {
+	return int(e.value)
+}
+
+// NoteOffEventData returns the event data if e.Kind=EventNoteOff.
+// The return values are: whether it's a note cut (as opposed to the key-off).
+// The key-off lets the instrument envelope fade out the note,
+// while the cut silences it immediately.
+func (e StreamEvent) NoteOffEventData() (cut bool) {
+	return e.value != 0
+}
+
+// EffectEventData returns the event data if e.Kind=EventEffect.
+// The return values are: the effect operation and its argument.
+// For most effects, the argument is an XM effect parameter;
+// for the sub-command effects (like E1x), it's the lower 4 bits of the parameter.
+func (e StreamEvent) EffectEventData() (op EffectOp, arg uint8) {
+	return EffectOp(e.value & 0xffffffff), uint8(e.value >> 32)
+}
+
+// LoopEventData returns the event data if e.Kind=EventLoop.
+// The return values are: the number of completed loop iterations (including this one)
+// and whether it's a whole song loop (as opposed to the loop range).
+func (e StreamEvent) LoopEventData() (count int, song bool) {
+	return int(e.value & 0xffffffff), (e.value>>32)&1 != 0
+}
@@ -0,0 +1,64 @@
+package xm
+
+type streamFade struct {
+	active bool
+
+	target float64
+	remain float64 // Fade time remaining (in seconds)
+
+	// stop is set for FadeOut: the stream ends after the fade is completed.
+	// stopped is set when this happens.
+	stop    bool
+	stopped bool
+}
+
+// FadeTo changes the stream volume linearly to the specified value
+// during the given time (in seconds).
+// It replaces the active fade (if any).
+// The volume value is clamped in [0, 1], see SetVolume.
+//
+// The volume is updated on every tick and it's smoothed
+// by the channel volume ramping, so there are no clicks.
+// The fade duration is measured in the playback time,
+// so it's affected by SetSpeedMultiplier.
+//
+// The fade state is not a part of the StreamSnapshot.
+func (s *Stream) FadeTo(volume, seconds float64) {
+	s.startFade(volume, seconds, false)
+}
+
+// FadeOut is like FadeTo(0, seconds), but the stream ends
+// after the fade is completed: Read will return EOF.
+// This happens even if the stream is looping.
+//
+// Use Rewind (or Restore) and SetVolume to make the stream playable again.
+func (s *Stream) FadeOut(seconds float64) {
+	s.startFade(0, seconds, true)
+}
+
+// IsFading reports whether there is an active fade.
+func (s *Stream) IsFading() bool {
+	return s.fade.active
+}
+
+func (s *Stream) startFade(volume, seconds float64, stop bool) {
+	s.fade = streamFade{
+		active: true,
+		target: clamp(volume, 0, 1),
+		remain: seconds,
+		stop:   stop,
+	}
+}
+
+func (s *Stream) tickFade() {
+	f := &s.fade
+	if f.remain <= s.secondsPerTick {
+		s.settings.volumeScaling = f.target
+		f.active = false
+		f.stopped = f.stop
+		return
+	}
+	v := s.settings.volumeScaling
+	s.settings.volumeScaling = v + (f.target-v)*(s.secondsPerTick/f.remain)
+	f.remain -= s.secondsPerTick
+}
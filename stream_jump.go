@@ -0,0 +1,82 @@
+package xm
+
+// JumpTimingKind specifies the boundary at which a queued jump is executed.
+// See Stream.QueueJump.
+type JumpTimingKind int
+
+const (
+	// JumpNextRow executes the jump right after the current row.
+	JumpNextRow JumpTimingKind = iota
+
+	// JumpNextBeat executes the jump at the next beat boundary.
+	// A beat length is specified by JumpTiming.BeatRows.
+	// The beats are counted from the current pattern start.
+	JumpNextBeat
+
+	// JumpPatternEnd executes the jump after the last row of the current pattern.
+	JumpPatternEnd
+)
+
+// JumpTiming describes when a queued jump should be executed.
+type JumpTiming struct {
+	Kind JumpTimingKind
+
+	// BeatRows is a beat length in rows.
+	// It's only used for JumpNextBeat.
+	//
+	// A zero value means 4 rows.
+	BeatRows int
+}
+
+type queuedJump struct {
+	active bool
+	order  int
+	row    int
+	timing JumpTiming
+}
+
+// QueueJump schedules a jump to the specified pattern order position.
+// The jump is executed at the next boundary described by when.
+//
+// This is useful for the adaptive music (horizontal re-sequencing):
+// the song sections can be switched in a musically sensible moment.
+//
+// Only one jump can be queued at a time, queueing a new jump replaces the old one.
+// A queued jump takes precedence over the pattern break effects.
+// When the jump is executed, an EventJump is emitted.
+//
+// An error is returned if the order or row are out of bounds.
+func (s *Stream) QueueJump(order, row int, when JumpTiming) error {
+	if err := s.checkSongPos(order, row); err != nil {
+		return err
+	}
+	if when.Kind == JumpNextBeat && when.BeatRows <= 0 {
+		when.BeatRows = 4
+	}
+	s.queuedJump = queuedJump{
+		active: true,
+		order:  order,
+		row:    row,
+		timing: when,
+	}
+	return nil
+}
+
+// CancelQueuedJump removes the jump scheduled by QueueJump (if any).
+func (s *Stream) CancelQueuedJump() {
+	s.queuedJump.active = false
+}
+
+func (s *Stream) queuedJumpReady() bool {
+	// A pattern is ending either naturally or due to a pattern break.
+	patternEnd := s.patternRowsRemain == 0 || s.jumpKind != jumpNone
+
+	switch s.queuedJump.timing.Kind {
+	case JumpNextBeat:
+		return patternEnd || (s.patternRowIndex+1)%s.queuedJump.timing.BeatRows == 0
+	case JumpPatternEnd:
+		return patternEnd
+	default:
+		return true
+	}
+}
@@ -0,0 +1,87 @@
+package xm
+
+import (
+	"errors"
+)
+
+type loopRange struct {
+	active     bool
+	startOrder int
+	startRow   int
+	endOrder   int
+	endRow     int
+}
+
+// SetLoopRange makes the stream loop a part of the song.
+// After the end row is played, the playback continues from the start row.
+// The positions are specified as pattern order indexes and rows inside these patterns.
+//
+// This is useful for the songs with an intro: the intro is played once
+// and then the main part is looped.
+//
+// The loop range end overrides the pattern break effects of the end row.
+// A queued jump (see QueueJump) takes precedence over the loop range.
+// If the end row is never reached (e.g. it's skipped by a jump), the loop doesn't happen.
+//
+// The number of loop iterations can be limited by SetLoopCount.
+// After the last iteration, the song continues past the loop end (e.g. into the outro).
+// An EventLoop is emitted every time the loop wraps.
+//
+// The loop range is reset when a new module is assigned to the stream.
+//
+// An error is returned if any of the positions is out of bounds.
+func (s *Stream) SetLoopRange(startOrder, startRow, endOrder, endRow int) error {
+	if err := s.checkSongPos(startOrder, startRow); err != nil {
+		return err
+	}
+	if err := s.checkSongPos(endOrder, endRow); err != nil {
+		return err
+	}
+	s.settings.loopRange = loopRange{
+		active:     true,
+		startOrder: startOrder,
+		startRow:   startRow,
+		endOrder:   endOrder,
+		endRow:     endRow,
+	}
+	return nil
+}
+
+// ClearLoopRange removes the loop range set by SetLoopRange (if any).
+func (s *Stream) ClearLoopRange() {
+	s.settings.loopRange = loopRange{}
+}
+
+// SetLoopCount limits the number of loop iterations.
+// A value of 0 means that the looping is infinite (this is a default).
+// With n=2, the looped part is played 3 times: once normally and then 2 more times.
+//
+// If there is a loop range, the limit is applied to it (see SetLoopRange).
+// Otherwise, the limit is applied to the whole song looping (see SetLooping).
+// After the whole song loops, the loop range iterations are counted from zero again.
+//
+// Rewind resets the number of completed iterations.
+// Both loop kinds emit an EventLoop when they wrap.
+// The value is clamped to be non-negative.
+func (s *Stream) SetLoopCount(n int) {
+	s.settings.loopCount = clampMin(n, 0)
+}
+
+func (s *Stream) canLoop(loopsDone int) bool {
+	return s.settings.loopCount == 0 || loopsDone < s.settings.loopCount
+}
+
+func (s *Stream) loopRangeEnd() bool {
+	return s.patternIndex == s.settings.loopRange.endOrder &&
+		s.patternRowIndex == s.settings.loopRange.endRow
+}
+
+func (s *Stream) checkSongPos(order, row int) error {
+	if order < 0 || order >= len(s.module.patternOrder) {
+		return errors.New("pattern order index is out of bounds")
+	}
+	if row < 0 || row >= s.module.patternOrder[order].numRows {
+		return errors.New("pattern row index is out of bounds")
+	}
+	return nil
+}
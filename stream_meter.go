@@ -0,0 +1,248 @@
+package xm
+
+import (
+	"math"
+	"sync"
+)
+
+// streamMeter collects the per-channel levels during the tick rendering.
+//
+// The accumulators are only accessed by the goroutine that reads the stream.
+// The results are published once per tick; they're protected by the mutex,
+// so they can be read from any goroutine.
+type streamMeter struct {
+	sumSquares []float64
+	peaks      []float64
+	numFrames  int
+
+	// scope contains a ring buffer per channel.
+	// All rings share the same write position.
+	scope     []float32
+	scopeSize int
+	scopePos  int
+
+	mu             sync.Mutex
+	publishedRMS   []float32
+	publishedPeaks []float32
+	publishedScope []float32
+	publishedPos   int
+}
+
+// EnableMetering turns the per-channel level metering on or off.
+// When enabled, the stream computes the RMS and peak levels
+// of every channel output during each tick.
+// See ChannelLevels, ChannelPeaks and ChannelScope.
+//
+// The metering uses a separate (slower) rendering path,
+// so it has no overhead when it's disabled (this is a default).
+// Disabling the metering also disables the channel scopes.
+//
+// Like other stream settings methods, it should not be called
+// concurrently with Read. Only the metering results getters are concurrency-safe.
+func (s *Stream) EnableMetering(enabled bool) {
+	if !enabled {
+		s.settings.meter = nil
+		return
+	}
+	if s.settings.meter == nil {
+		s.settings.meter = &streamMeter{}
+	}
+}
+
+// SetChannelScopeSize enables the per-channel scope buffers.
+// A scope buffer holds the last n rendered samples of the channel
+// (left and right are mixed into one mono sample).
+// A value of 0 disables the scopes (this is a default).
+//
+// It has no effect unless the metering is enabled, see EnableMetering.
+func (s *Stream) SetChannelScopeSize(n int) {
+	m := s.settings.meter
+	if m == nil {
+		return
+	}
+	m.scopeSize = clampMin(n, 0)
+	m.scopePos = 0
+	m.scope = make([]float32, len(s.channels)*m.scopeSize)
+	m.mu.Lock()
+	m.publishedScope = make([]float32, len(m.scope))
+	m.publishedPos = 0
+	m.mu.Unlock()
+}
+
+// ChannelLevels writes the RMS level of every channel into dst.
+// The levels are in [0, 1] range and they're measured during the last rendered tick.
+// It returns the number of written values: min(len(dst), NumChannels).
+//
+// If the metering is disabled, it returns 0.
+//
+// This method can be called from any goroutine.
+func (s *Stream) ChannelLevels(dst []float32) int {
+	m := s.settings.meter
+	if m == nil {
+		return 0
+	}
+	m.mu.Lock()
+	n := copy(dst, m.publishedRMS)
+	m.mu.Unlock()
+	return n
+}
+
+// ChannelPeaks is like ChannelLevels, but it reports the peak (max absolute) levels.
+//
+// This method can be called from any goroutine.
+func (s *Stream) ChannelPeaks(dst []float32) int {
+	m := s.settings.meter
+	if m == nil {
+		return 0
+	}
+	m.mu.Lock()
+	n := copy(dst, m.publishedPeaks)
+	m.mu.Unlock()
+	return n
+}
+
+// ChannelScope writes the last rendered samples of the channel into dst,
+// from the oldest to the newest.
+// The samples are in [-1, 1] range.
+// It returns the number of written values: min(len(dst), scope size).
+// If there are more samples than dst can hold, the newest ones are written.
+//
+// If the metering or the scopes are disabled, it returns 0.
+// An out of bounds channel index results in 0 as well.
+// See SetChannelScopeSize.
+//
+// This method can be called from any goroutine.
+func (s *Stream) ChannelScope(ch int, dst []float32) int {
+	m := s.settings.meter
+	if m == nil {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	size := m.scopeSize
+	if size == 0 || ch < 0 || (ch+1)*size > len(m.publishedScope) {
+		return 0
+	}
+	ring := m.publishedScope[ch*size : (ch+1)*size]
+	n := min(len(dst), size)
+	// The write position points to the oldest sample.
+	start := m.publishedPos + (size - n)
+	for i := 0; i < n; i++ {
+		dst[i] = ring[(start+i)%size]
+	}
+	return n
+}
+
+func (m *streamMeter) beginTick(numChannels, numFrames int) {
+	if len(m.sumSquares) != numChannels {
+		m.sumSquares = make([]float64, numChannels)
+		m.peaks = make([]float64, numChannels)
+		m.scope = make([]float32, numChannels*m.scopeSize)
+		m.scopePos = 0
+	}
+	clear(m.sumSquares)
+	clear(m.peaks)
+	m.numFrames = numFrames
+
+	// Inactive channels are not rendered, so their scope samples need to be zeroed in advance.
+	if m.scopeSize != 0 {
+		if numFrames >= m.scopeSize {
+			clear(m.scope)
+		} else {
+			for ch := 0; ch < numChannels; ch++ {
+				ring := m.scope[ch*m.scopeSize : (ch+1)*m.scopeSize]
+				for i := 0; i < numFrames; i++ {
+					ring[(m.scopePos+i)%m.scopeSize] = 0
+				}
+			}
+		}
+	}
+}
+
+func (m *streamMeter) add(ch, frame int, left, right int16) {
+	x := (float64(left) + float64(right)) / (2 * 32768)
+	m.sumSquares[ch] += x * x
+	if a := abs(x); a > m.peaks[ch] {
+		m.peaks[ch] = a
+	}
+	if m.scopeSize != 0 {
+		m.scope[ch*m.scopeSize+(m.scopePos+frame)%m.scopeSize] = float32(x)
+	}
+}
+
+func (m *streamMeter) endTick() {
+	if m.scopeSize != 0 {
+		m.scopePos = (m.scopePos + m.numFrames) % m.scopeSize
+	}
+
+	m.mu.Lock()
+	if len(m.publishedRMS) != len(m.sumSquares) {
+		m.publishedRMS = make([]float32, len(m.sumSquares))
+		m.publishedPeaks = make([]float32, len(m.sumSquares))
+	}
+	for i, sum := range m.sumSquares {
+		m.publishedRMS[i] = float32(math.Sqrt(sum / float64(m.numFrames)))
+		m.publishedPeaks[i] = float32(m.peaks[i])
+	}
+	if len(m.publishedScope) != len(m.scope) {
+		m.publishedScope = make([]float32, len(m.scope))
+	}
+	copy(m.publishedScope, m.scope)
+	m.publishedPos = m.scopePos
+	m.mu.Unlock()
+}
+
+// readTickMetered is like readTick, but it also collects the channel levels.
+// It's a separate function to keep the readTick as fast as possible.
+func (s *Stream) readTickMetered(b []byte) {
+	m := s.settings.meter
+
+	n := len(b)
+	m.beginTick(len(s.channels), n/4)
+
+	const (
+		rampBytes  = 2 * 2 * numRampPoints
+		volumeRamp = 1.0 / 180.0
+	)
+
+	for i := 0; i < rampBytes; i += 4 {
+		left := int16(0)
+		right := int16(0)
+
+		for _, ch := range s.activeChannels {
+			v := float64(ch.NextSample())
+			if ch.rampFrame < uint(len(ch.rampSamples)) {
+				v = lerp(ch.rampSamples[ch.rampFrame], v, float64(ch.rampFrame)/float64(len(ch.rampSamples)))
+			}
+			chLeft := int16(v * ch.computedVolume[0])
+			chRight := int16(v * ch.computedVolume[1])
+			left += chLeft
+			right += chRight
+			m.add(ch.id, i/4, chLeft, chRight)
+			ch.rampFrame++
+			ch.computedVolume[0] = slideTowards(ch.computedVolume[0], ch.targetVolume[0], volumeRamp)
+			ch.computedVolume[1] = slideTowards(ch.computedVolume[1], ch.targetVolume[1], volumeRamp)
+		}
+
+		putPCM(b[i:], uint16(left), uint16(right))
+	}
+
+	for i := rampBytes; i < n; i += 4 {
+		left := int16(0)
+		right := int16(0)
+
+		for _, ch := range s.activeChannels {
+			v := float64(ch.NextSample())
+			chLeft := int16(v * ch.computedVolume[0])
+			chRight := int16(v * ch.computedVolume[1])
+			left += chLeft
+			right += chRight
+			m.add(ch.id, i/4, chLeft, chRight)
+		}
+
+		putPCM(b[i:], uint16(left), uint16(right))
+	}
+
+	m.endTick()
+}
@@ -0,0 +1,34 @@
+package xm
+
+import (
+	"testing"
+)
+
+func TestStreamChannelScope(t *testing.T) {
+	s := newTestStream(t)
+	s.EnableMetering(true)
+	s.SetChannelScopeSize(64)
+	readFrames(t, s, 2*882)
+
+	dst := make([]float32, 64)
+	if n := s.ChannelScope(0, dst); n != len(dst) {
+		t.Fatalf("channel 0 scope: got %d samples, want %d", n, len(dst))
+	}
+	nonZero := false
+	for _, v := range dst {
+		if v < -1 || v > 1 {
+			t.Fatalf("scope sample %f is out of [-1, 1] range", v)
+		}
+		nonZero = nonZero || v != 0
+	}
+	if !nonZero {
+		t.Fatal("channel 0 scope is silent")
+	}
+
+	// Out of bounds channel indexes are ignored.
+	for _, ch := range []int{-1, -2, 2} {
+		if n := s.ChannelScope(ch, dst); n != 0 {
+			t.Fatalf("channel %d scope: got %d samples, want 0", ch, n)
+		}
+	}
+}
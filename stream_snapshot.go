@@ -0,0 +1,651 @@
+package xm
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// StreamSnapshot is an opaque stream playback state.
+// Use Stream.Snapshot to create it and Stream.Restore to apply it.
+//
+// A snapshot includes everything that changes during the playback:
+// the pattern position, tick, channels state (including envelopes and effect memory),
+// global volume, tempo and BPM, queued jump, the number of completed loop iterations.
+// The stream settings (volume scaling, looping, channel controls, event handler, etc.)
+// are not a part of the snapshot.
+//
+// A snapshot can be serialized via MarshalBinary and then decoded back via UnmarshalBinary.
+// It can only be restored for a stream that plays the same module.
+type StreamSnapshot struct {
+	fingerprint moduleFingerprint
+
+	patternIndex      int
+	patternRowsRemain int
+	patternRowIndex   int
+	rowTicksRemain    int
+	tickIndex         int
+
+	jumpKind    jumpKind
+	jumpPattern int
+	jumpRow     int
+
+	queuedJump     queuedJump
+	rangeLoopsDone int
+	songLoopsDone  int
+
+	globalVolume float64
+	bpm          float64
+	ticksPerRow  int
+	bytePos      int
+	playedBytes  int
+	t            float64
+
+	// channels are copied as is, except for the module-related pointers.
+	// These pointers are stored as indexes.
+	channels     []streamChannel
+	instIndexes  []int
+	noteIndexes  []int
+	pendingBytes []byte
+}
+
+// moduleFingerprint is used to check whether a snapshot can be applied.
+type moduleFingerprint struct {
+	numChannels    int
+	numInstruments int
+	numOrders      int
+	numNotes       int
+	numEffects     int
+}
+
+func makeModuleFingerprint(m *module) moduleFingerprint {
+	return moduleFingerprint{
+		numChannels:    m.numChannels,
+		numInstruments: len(m.instruments),
+		numOrders:      len(m.patternOrder),
+		numNotes:       len(m.noteTab),
+		numEffects:     len(m.effectTab),
+	}
+}
+
+const (
+	snapshotMagic   = "XMSS"
+	snapshotVersion = 1
+)
+
+// Snapshot captures the current stream playback state.
+// It's safe to keep the snapshot after the stream module is changed.
+//
+// See StreamSnapshot docs to learn what is being captured.
+func (s *Stream) Snapshot() *StreamSnapshot {
+	snapshot := &StreamSnapshot{
+		fingerprint: makeModuleFingerprint(s.module),
+
+		patternIndex:      s.patternIndex,
+		patternRowsRemain: s.patternRowsRemain,
+		patternRowIndex:   s.patternRowIndex,
+		rowTicksRemain:    s.rowTicksRemain,
+		tickIndex:         s.tickIndex,
+
+		jumpKind:    s.jumpKind,
+		jumpPattern: s.jumpPattern,
+		jumpRow:     s.jumpRow,
+
+		queuedJump:     s.queuedJump,
+		rangeLoopsDone: s.rangeLoopsDone,
+		songLoopsDone:  s.songLoopsDone,
+
+		globalVolume: s.globalVolume,
+		bpm:          s.bpm,
+		ticksPerRow:  s.ticksPerRow,
+		bytePos:      s.bytePos,
+		playedBytes:  s.playedBytes,
+		t:            s.t,
+
+		channels:     make([]streamChannel, len(s.channels)),
+		instIndexes:  make([]int, len(s.channels)),
+		noteIndexes:  make([]int, len(s.channels)),
+		pendingBytes: append([]byte(nil), s.tickPending...),
+	}
+
+	for i := range s.channels {
+		ch := &s.channels[i]
+		snapshot.instIndexes[i] = -1
+		if ch.inst != nil {
+			snapshot.instIndexes[i] = instrumentIndex(s.module, ch.inst)
+		}
+		snapshot.noteIndexes[i] = -1
+		if ch.note != nil {
+			snapshot.noteIndexes[i] = noteIndex(s.module, ch.note)
+		}
+
+		// Envelopes are always the copies of the current instrument envelopes.
+		// They'll be recovered from the instrument during the restore.
+		dst := &snapshot.channels[i]
+		*dst = *ch
+		dst.inst = nil
+		dst.note = nil
+		dst.volumeEnvelope.envelope = envelope{}
+		dst.panningEnvelope.envelope = envelope{}
+	}
+
+	return snapshot
+}
+
+// Restore applies the previously captured playback state.
+//
+// An error is returned if the snapshot is not compatible
+// with the module that is currently assigned to the stream.
+func (s *Stream) Restore(snapshot *StreamSnapshot) error {
+	if err := snapshot.validate(s.module); err != nil {
+		return err
+	}
+
+	s.patternIndex = snapshot.patternIndex
+	s.pattern = nil
+	if s.patternIndex != -1 {
+		s.pattern = s.module.patternOrder[s.patternIndex]
+	}
+	s.patternRowsRemain = snapshot.patternRowsRemain
+	s.patternRowIndex = snapshot.patternRowIndex
+	s.rowTicksRemain = snapshot.rowTicksRemain
+	s.tickIndex = snapshot.tickIndex
+
+	s.jumpKind = snapshot.jumpKind
+	s.jumpPattern = snapshot.jumpPattern
+	s.jumpRow = snapshot.jumpRow
+
+	s.queuedJump = snapshot.queuedJump
+	s.rangeLoopsDone = snapshot.rangeLoopsDone
+	s.songLoopsDone = snapshot.songLoopsDone
+	s.songEnded = false
+	// A stream stopped by FadeOut becomes playable again.
+	s.fade.stopped = false
+
+	s.globalVolume = snapshot.globalVolume
+	s.setTempo(snapshot.ticksPerRow)
+	s.setBPM(snapshot.bpm)
+	s.bytePos = snapshot.bytePos
+	s.playedBytes = snapshot.playedBytes
+	s.t = snapshot.t
+
+	for i := range s.channels {
+		ch := &s.channels[i]
+		*ch = snapshot.channels[i]
+		ch.id = i
+		if j := snapshot.instIndexes[i]; j != -1 {
+			ch.inst = &s.module.instruments[j]
+			ch.volumeEnvelope.envelope = ch.inst.volumeEnvelope
+			ch.panningEnvelope.envelope = ch.inst.panningEnvelope
+		}
+		if j := snapshot.noteIndexes[i]; j != -1 {
+			ch.note = &s.module.noteTab[j]
+		}
+	}
+	// Active channels will be re-collected during the next tick.
+	s.activeChannels = s.activeChannels[:0]
+
+	s.tickPending = nil
+	if len(snapshot.pendingBytes) != 0 {
+		if cap(s.tickBuf) < len(snapshot.pendingBytes) {
+			s.tickBuf = make([]byte, len(snapshot.pendingBytes))
+		}
+		s.tickPending = s.tickBuf[:len(snapshot.pendingBytes)]
+		copy(s.tickPending, snapshot.pendingBytes)
+	}
+
+	return nil
+}
+
+func (snapshot *StreamSnapshot) validate(m *module) error {
+	if snapshot.fingerprint != makeModuleFingerprint(m) {
+		return errors.New("snapshot was created for a different module")
+	}
+
+	numOrders := len(m.patternOrder)
+	if snapshot.patternIndex < -1 || snapshot.patternIndex >= numOrders {
+		return errors.New("snapshot pattern index is out of bounds")
+	}
+	if snapshot.patternIndex != -1 {
+		p := m.patternOrder[snapshot.patternIndex]
+		if snapshot.patternRowIndex < -1 || snapshot.patternRowIndex >= p.numRows {
+			return errors.New("snapshot pattern row index is out of bounds")
+		}
+		if snapshot.patternRowsRemain < 0 || snapshot.patternRowIndex+snapshot.patternRowsRemain >= p.numRows {
+			return errors.New("snapshot pattern rows counter is out of bounds")
+		}
+	} else if snapshot.patternRowsRemain != 0 {
+		return errors.New("snapshot pattern rows counter is out of bounds")
+	}
+	if snapshot.rowTicksRemain < 0 || snapshot.tickIndex < -1 {
+		return errors.New("snapshot tick counters are out of bounds")
+	}
+
+	switch snapshot.jumpKind {
+	case jumpNone:
+		// OK.
+	case jumpPatternBreak, jumpQueued, jumpLoop:
+		// A pattern break on the last pattern points right past the last order.
+		if snapshot.jumpPattern < 0 || snapshot.jumpPattern > numOrders || snapshot.jumpRow < 0 {
+			return errors.New("snapshot jump position is out of bounds")
+		}
+	default:
+		return errors.New("snapshot jump kind is invalid")
+	}
+
+	if j := &snapshot.queuedJump; j.active {
+		if j.order < 0 || j.order >= numOrders || j.row < 0 || j.row >= m.patternOrder[j.order].numRows {
+			return errors.New("snapshot queued jump position is out of bounds")
+		}
+		switch j.timing.Kind {
+		case JumpNextRow, JumpPatternEnd:
+			// OK.
+		case JumpNextBeat:
+			if j.timing.BeatRows <= 0 {
+				return errors.New("snapshot queued jump beat length is invalid")
+			}
+		default:
+			return errors.New("snapshot queued jump timing is invalid")
+		}
+	}
+	if snapshot.bpm <= 0 || snapshot.ticksPerRow <= 0 {
+		return errors.New("snapshot contains invalid tempo values")
+	}
+
+	for i := range snapshot.channels {
+		if j := snapshot.instIndexes[i]; j < -1 || j >= len(m.instruments) {
+			return errors.New("snapshot instrument index is out of bounds")
+		}
+		if j := snapshot.noteIndexes[i]; j < -1 || j >= len(m.noteTab) {
+			return errors.New("snapshot note index is out of bounds")
+		}
+		ch := &snapshot.channels[i]
+		k := ch.effect
+		if k.Index()+k.Len() > uint(len(m.effectTab)) {
+			return errors.New("snapshot effect index is out of bounds")
+		}
+		if !ch.hasFiniteValues() {
+			return errors.New("snapshot channel contains non-finite values")
+		}
+		if ch.sampleOffset < 0 {
+			return errors.New("snapshot sample offset is out of bounds")
+		}
+		// Effects and the row ticks are processed using the channel note.
+		if snapshot.noteIndexes[i] == -1 {
+			if !k.IsEmpty() || ch.arpeggioRunning || ch.vibratoRunning {
+				return errors.New("snapshot channel has running effects without a note")
+			}
+			if snapshot.rowTicksRemain > 0 {
+				return errors.New("snapshot has pending row ticks for a channel without a note")
+			}
+		}
+	}
+
+	return nil
+}
+
+func (ch *streamChannel) hasFiniteValues() bool {
+	values := [...]float64{
+		ch.computedVolume[0],
+		ch.computedVolume[1],
+		ch.targetVolume[0],
+		ch.targetVolume[1],
+		ch.sampleOffset,
+		ch.period,
+		ch.sampleStep,
+		ch.panning,
+		ch.volume,
+		ch.fadeoutVolume,
+		ch.arpeggioNoteOffset,
+		ch.panningSlideValue,
+		ch.volumeSlideValue,
+		ch.globalVolumeSlideValue,
+		ch.portamentoUpValue,
+		ch.portamentoDownValue,
+		ch.notePortamentoTargetPeriod,
+		ch.notePortamentoValue,
+		ch.vibratoPeriodOffset,
+		ch.vibratoDepth,
+		ch.volumeEnvelope.value,
+		ch.panningEnvelope.value,
+	}
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return false
+		}
+	}
+	for _, v := range ch.rampSamples {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+//
+// The encoded data is versioned: newer versions of this
+// library will be able to decode the older snapshots.
+func (snapshot *StreamSnapshot) MarshalBinary() ([]byte, error) {
+	var enc snapshotEncoder
+	enc.buf = make([]byte, 0, 512+len(snapshot.channels)*512+len(snapshot.pendingBytes))
+
+	enc.buf = append(enc.buf, snapshotMagic...)
+	enc.uint(snapshotVersion)
+
+	f := &snapshot.fingerprint
+	enc.int(f.numChannels)
+	enc.int(f.numInstruments)
+	enc.int(f.numOrders)
+	enc.int(f.numNotes)
+	enc.int(f.numEffects)
+
+	enc.int(snapshot.patternIndex)
+	enc.int(snapshot.patternRowsRemain)
+	enc.int(snapshot.patternRowIndex)
+	enc.int(snapshot.rowTicksRemain)
+	enc.int(snapshot.tickIndex)
+
+	enc.uint(uint64(snapshot.jumpKind))
+	enc.int(snapshot.jumpPattern)
+	enc.int(snapshot.jumpRow)
+
+	enc.bool(snapshot.queuedJump.active)
+	enc.int(snapshot.queuedJump.order)
+	enc.int(snapshot.queuedJump.row)
+	enc.int(int(snapshot.queuedJump.timing.Kind))
+	enc.int(snapshot.queuedJump.timing.BeatRows)
+	enc.int(snapshot.rangeLoopsDone)
+	enc.int(snapshot.songLoopsDone)
+
+	enc.float(snapshot.globalVolume)
+	enc.float(snapshot.bpm)
+	enc.int(snapshot.ticksPerRow)
+	enc.int(snapshot.bytePos)
+	enc.int(snapshot.playedBytes)
+	enc.float(snapshot.t)
+
+	enc.uint(uint64(len(snapshot.channels)))
+	for i := range snapshot.channels {
+		enc.int(snapshot.instIndexes[i])
+		enc.int(snapshot.noteIndexes[i])
+		enc.channel(&snapshot.channels[i])
+	}
+
+	enc.uint(uint64(len(snapshot.pendingBytes)))
+	enc.buf = append(enc.buf, snapshot.pendingBytes...)
+
+	return enc.buf, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+//
+// It only checks the data format; the compatibility
+// with the module is checked by Stream.Restore.
+func (snapshot *StreamSnapshot) UnmarshalBinary(data []byte) error {
+	if len(data) < len(snapshotMagic) || string(data[:len(snapshotMagic)]) != snapshotMagic {
+		return errors.New("invalid snapshot data: bad magic")
+	}
+	dec := snapshotDecoder{buf: data[len(snapshotMagic):]}
+	version := dec.uint()
+	if dec.err == nil && version != snapshotVersion {
+		return errors.New("invalid snapshot data: unsupported version")
+	}
+
+	var result StreamSnapshot
+
+	f := &result.fingerprint
+	f.numChannels = dec.int()
+	f.numInstruments = dec.int()
+	f.numOrders = dec.int()
+	f.numNotes = dec.int()
+	f.numEffects = dec.int()
+
+	result.patternIndex = dec.int()
+	result.patternRowsRemain = dec.int()
+	result.patternRowIndex = dec.int()
+	result.rowTicksRemain = dec.int()
+	result.tickIndex = dec.int()
+
+	result.jumpKind = jumpKind(dec.uint())
+	result.jumpPattern = dec.int()
+	result.jumpRow = dec.int()
+
+	result.queuedJump.active = dec.bool()
+	result.queuedJump.order = dec.int()
+	result.queuedJump.row = dec.int()
+	result.queuedJump.timing.Kind = JumpTimingKind(dec.int())
+	result.queuedJump.timing.BeatRows = dec.int()
+	result.rangeLoopsDone = dec.int()
+	result.songLoopsDone = dec.int()
+
+	result.globalVolume = dec.float()
+	result.bpm = dec.float()
+	result.ticksPerRow = dec.int()
+	result.bytePos = dec.int()
+	result.playedBytes = dec.int()
+	result.t = dec.float()
+
+	numChannels := dec.length()
+	if dec.err == nil && numChannels != f.numChannels {
+		return errors.New("invalid snapshot data: channel count mismatch")
+	}
+	result.channels = make([]streamChannel, numChannels)
+	result.instIndexes = make([]int, numChannels)
+	result.noteIndexes = make([]int, numChannels)
+	for i := range result.channels {
+		result.instIndexes[i] = dec.int()
+		result.noteIndexes[i] = dec.int()
+		dec.channel(&result.channels[i])
+	}
+
+	numPending := dec.length()
+	result.pendingBytes = append([]byte(nil), dec.bytes(numPending)...)
+
+	if dec.err != nil {
+		return dec.err
+	}
+	if len(dec.buf) != 0 {
+		return errors.New("invalid snapshot data: trailing bytes")
+	}
+
+	*snapshot = result
+	return nil
+}
+
+type snapshotEncoder struct {
+	buf []byte
+}
+
+func (enc *snapshotEncoder) int(v int) {
+	enc.buf = binary.AppendVarint(enc.buf, int64(v))
+}
+
+func (enc *snapshotEncoder) uint(v uint64) {
+	enc.buf = binary.AppendUvarint(enc.buf, v)
+}
+
+func (enc *snapshotEncoder) float(v float64) {
+	enc.buf = binary.LittleEndian.AppendUint64(enc.buf, math.Float64bits(v))
+}
+
+func (enc *snapshotEncoder) bool(v bool) {
+	b := byte(0)
+	if v {
+		b = 1
+	}
+	enc.buf = append(enc.buf, b)
+}
+
+func (enc *snapshotEncoder) envelope(e *envelopeRunner) {
+	enc.float(e.value)
+	enc.int(e.frame)
+}
+
+func (enc *snapshotEncoder) channel(ch *streamChannel) {
+	enc.float(ch.computedVolume[0])
+	enc.float(ch.computedVolume[1])
+	enc.float(ch.targetVolume[0])
+	enc.float(ch.targetVolume[1])
+	enc.float(ch.sampleOffset)
+
+	enc.float(ch.period)
+	enc.float(ch.sampleStep)
+	enc.uint(uint64(ch.effect))
+	enc.bool(ch.keyOn)
+
+	enc.float(ch.panning)
+	enc.float(ch.volume)
+	enc.float(ch.fadeoutVolume)
+
+	enc.uint(uint64(ch.rampFrame))
+	for _, v := range ch.rampSamples {
+		enc.float(v)
+	}
+
+	enc.bool(ch.arpeggioRunning)
+	enc.float(ch.arpeggioNoteOffset)
+
+	enc.float(ch.panningSlideValue)
+	enc.float(ch.volumeSlideValue)
+	enc.float(ch.globalVolumeSlideValue)
+	enc.float(ch.portamentoUpValue)
+	enc.float(ch.portamentoDownValue)
+
+	enc.float(ch.notePortamentoTargetPeriod)
+	enc.float(ch.notePortamentoValue)
+
+	enc.bool(ch.vibratoRunning)
+	enc.float(ch.vibratoPeriodOffset)
+	enc.float(ch.vibratoDepth)
+	enc.uint(uint64(ch.vibratoStep))
+	enc.uint(uint64(ch.vibratoSpeed))
+
+	enc.bool(ch.reverse)
+
+	enc.envelope(&ch.volumeEnvelope)
+	enc.envelope(&ch.panningEnvelope)
+}
+
+type snapshotDecoder struct {
+	buf []byte
+	err error
+}
+
+func (dec *snapshotDecoder) fail() {
+	if dec.err == nil {
+		dec.err = errors.New("invalid snapshot data: unexpected end of data")
+	}
+	dec.buf = nil
+}
+
+func (dec *snapshotDecoder) int() int {
+	v, n := binary.Varint(dec.buf)
+	if n <= 0 {
+		dec.fail()
+		return 0
+	}
+	dec.buf = dec.buf[n:]
+	return int(v)
+}
+
+func (dec *snapshotDecoder) uint() uint64 {
+	v, n := binary.Uvarint(dec.buf)
+	if n <= 0 {
+		dec.fail()
+		return 0
+	}
+	dec.buf = dec.buf[n:]
+	return v
+}
+
+func (dec *snapshotDecoder) length() int {
+	v := dec.uint()
+	if v > uint64(len(dec.buf)) {
+		// Every element requires at least 1 byte,
+		// so a length can't exceed the remaining data size.
+		dec.fail()
+		return 0
+	}
+	return int(v)
+}
+
+func (dec *snapshotDecoder) float() float64 {
+	if len(dec.buf) < 8 {
+		dec.fail()
+		return 0
+	}
+	v := math.Float64frombits(binary.LittleEndian.Uint64(dec.buf))
+	dec.buf = dec.buf[8:]
+	return v
+}
+
+func (dec *snapshotDecoder) bool() bool {
+	if len(dec.buf) < 1 {
+		dec.fail()
+		return false
+	}
+	v := dec.buf[0] != 0
+	dec.buf = dec.buf[1:]
+	return v
+}
+
+func (dec *snapshotDecoder) bytes(n int) []byte {
+	if len(dec.buf) < n {
+		dec.fail()
+		return nil
+	}
+	v := dec.buf[:n]
+	dec.buf = dec.buf[n:]
+	return v
+}
+
+func (dec *snapshotDecoder) envelope(e *envelopeRunner) {
+	e.value = dec.float()
+	e.frame = dec.int()
+}
+
+func (dec *snapshotDecoder) channel(ch *streamChannel) {
+	ch.computedVolume[0] = dec.float()
+	ch.computedVolume[1] = dec.float()
+	ch.targetVolume[0] = dec.float()
+	ch.targetVolume[1] = dec.float()
+	ch.sampleOffset = dec.float()
+
+	ch.period = dec.float()
+	ch.sampleStep = dec.float()
+	ch.effect = effectKey(dec.uint())
+	ch.keyOn = dec.bool()
+
+	ch.panning = dec.float()
+	ch.volume = dec.float()
+	ch.fadeoutVolume = dec.float()
+
+	ch.rampFrame = uint(dec.uint())
+	for i := range ch.rampSamples {
+		ch.rampSamples[i] = dec.float()
+	}
+
+	ch.arpeggioRunning = dec.bool()
+	ch.arpeggioNoteOffset = dec.float()
+
+	ch.panningSlideValue = dec.float()
+	ch.volumeSlideValue = dec.float()
+	ch.globalVolumeSlideValue = dec.float()
+	ch.portamentoUpValue = dec.float()
+	ch.portamentoDownValue = dec.float()
+
+	ch.notePortamentoTargetPeriod = dec.float()
+	ch.notePortamentoValue = dec.float()
+
+	ch.vibratoRunning = dec.bool()
+	ch.vibratoPeriodOffset = dec.float()
+	ch.vibratoDepth = dec.float()
+	ch.vibratoStep = uint8(dec.uint())
+	ch.vibratoSpeed = uint8(dec.uint())
+
+	ch.reverse = dec.bool()
+
+	dec.envelope(&ch.volumeEnvelope)
+	dec.envelope(&ch.panningEnvelope)
+}
@@ -0,0 +1,156 @@
+package xm
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"testing"
+)
+
+func TestStreamSnapshotValidate(t *testing.T) {
+	// Every corruption would make the stream panic after Restore.
+	tests := []struct {
+		name    string
+		corrupt func(snapshot *StreamSnapshot)
+	}{
+		{"negative jump pattern", func(snapshot *StreamSnapshot) {
+			snapshot.jumpKind = jumpPatternBreak
+			snapshot.jumpPattern = -3
+		}},
+		{"jump pattern past the end", func(snapshot *StreamSnapshot) {
+			snapshot.jumpKind = jumpQueued
+			snapshot.jumpPattern = 4
+		}},
+		{"negative jump row", func(snapshot *StreamSnapshot) {
+			snapshot.jumpKind = jumpLoop
+			snapshot.jumpRow = -1
+		}},
+		{"invalid jump kind", func(snapshot *StreamSnapshot) {
+			snapshot.jumpKind = 100
+		}},
+		{"queued jump row", func(snapshot *StreamSnapshot) {
+			snapshot.queuedJump = queuedJump{active: true, order: 1, row: 16}
+		}},
+		{"queued jump beat rows", func(snapshot *StreamSnapshot) {
+			snapshot.queuedJump = queuedJump{active: true, timing: JumpTiming{Kind: JumpNextBeat}}
+		}},
+		{"queued jump timing", func(snapshot *StreamSnapshot) {
+			snapshot.queuedJump = queuedJump{active: true, timing: JumpTiming{Kind: -1}}
+		}},
+		{"tick index", func(snapshot *StreamSnapshot) {
+			snapshot.tickIndex = -5
+		}},
+		{"row ticks", func(snapshot *StreamSnapshot) {
+			snapshot.rowTicksRemain = -1
+		}},
+		{"pattern rows", func(snapshot *StreamSnapshot) {
+			snapshot.patternRowsRemain = 16
+		}},
+		{"negative sample offset", func(snapshot *StreamSnapshot) {
+			snapshot.channels[0].sampleOffset = -100
+		}},
+		{"NaN sample offset", func(snapshot *StreamSnapshot) {
+			snapshot.channels[0].sampleOffset = math.NaN()
+		}},
+		{"infinite period", func(snapshot *StreamSnapshot) {
+			snapshot.channels[0].period = math.Inf(-1)
+		}},
+		{"arpeggio without a note", func(snapshot *StreamSnapshot) {
+			snapshot.rowTicksRemain = 0
+			snapshot.noteIndexes[1] = -1
+			snapshot.channels[1].arpeggioRunning = true
+		}},
+		{"row ticks without a note", func(snapshot *StreamSnapshot) {
+			snapshot.rowTicksRemain = 2
+			snapshot.noteIndexes[1] = -1
+		}},
+	}
+
+	s := newTestStream(t)
+	readFrames(t, s, 10*882)
+	valid := s.Snapshot()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			snapshot := *valid
+			snapshot.channels = append([]streamChannel(nil), valid.channels...)
+			snapshot.noteIndexes = append([]int(nil), valid.noteIndexes...)
+			test.corrupt(&snapshot)
+			if err := s.Restore(&snapshot); err == nil {
+				t.Fatal("expected an error")
+			}
+
+			// The snapshot should not survive the binary encoding either.
+			data, err := snapshot.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var decoded StreamSnapshot
+			if err := decoded.UnmarshalBinary(data); err != nil {
+				return
+			}
+			if err := s.Restore(&decoded); err == nil {
+				t.Fatal("expected an error for a decoded snapshot")
+			}
+		})
+	}
+
+	if err := s.Restore(valid); err != nil {
+		t.Fatalf("restore a valid snapshot: %v", err)
+	}
+}
+
+func TestStreamRestoreAfterFadeOut(t *testing.T) {
+	s := newTestStream(t)
+	readFrames(t, s, 10*882)
+	snapshot := s.Snapshot()
+
+	s.FadeOut(0.1)
+	buf := make([]byte, 4096)
+	for {
+		if _, err := s.Read(buf); err != nil {
+			break
+		}
+	}
+
+	if err := s.Restore(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	// The volume is 0 after the fade, but the stream should be playable.
+	if n, err := s.Read(buf); err != nil || n != len(buf) {
+		t.Fatalf("read after restore: n=%d err=%v", n, err)
+	}
+}
+
+func TestStreamSnapshotBinaryRoundtrip(t *testing.T) {
+	// The position is not aligned to the tick boundary,
+	// so the snapshot contains the pending tick bytes too.
+	s := newTestStream(t, testEffect{pattern: 0, row: 2, op: 0x00, arg: 0x37})
+	s.EnableMetering(true)
+	readFrames(t, s, 10*882+123)
+
+	data, err := s.Snapshot().MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded StreamSnapshot
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	restored := newTestStream(t, testEffect{pattern: 0, row: 2, op: 0x00, arg: 0x37})
+	restored.EnableMetering(true)
+	if err := restored.Restore(&decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := io.ReadAll(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	have, err := io.ReadAll(restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(want) == 0 || !bytes.Equal(have, want) {
+		t.Fatalf("restored stream output mismatch (%d vs %d bytes)", len(have), len(want))
+	}
+}
@@ -0,0 +1,138 @@
+package xm
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+)
+
+// spectrumSize is the FFT window size (in frames).
+// At 44100 Hz it's ~23ms of audio, so it's updated roughly every tick.
+const spectrumSize = 1024
+
+// streamSpectrum computes the band energies of the mixed output.
+//
+// Like streamMeter, it's updated by the goroutine that reads the stream
+// and the results are published once per tick.
+type streamSpectrum struct {
+	fft    *fft
+	window []float64 // Hann window coefficients
+
+	// history is a ring buffer of the last rendered mono samples.
+	history    []float64
+	historyPos int
+
+	re []float64
+	im []float64
+
+	// bandEdges[i] is the first FFT bin of the band i.
+	// The last element is the end of the last band.
+	bandEdges []int
+	bands     []float32
+
+	mu        sync.Mutex
+	published []float32
+}
+
+// EnableSpectrum turns the spectrum analysis of the mixed output on.
+// The spectrum is computed every tick and it's split into numBands
+// logarithmically spaced frequency bands (like in the music visualizers).
+// A value of 0 disables the analysis (this is a default).
+// The number of bands is clamped to 128.
+//
+// See SpectrumBands.
+//
+// Like other stream settings methods, it should not be called
+// concurrently with Read.
+func (s *Stream) EnableSpectrum(numBands int) {
+	if numBands <= 0 {
+		s.settings.spectrum = nil
+		return
+	}
+	s.settings.spectrum = newStreamSpectrum(min(numBands, 128))
+}
+
+// SpectrumBands writes the band levels of the last rendered tick into dst.
+// The values are in [0, 1] range (the loud music can have bands
+// with values slightly above 1), from the lowest to the highest frequency.
+// It returns the number of written values: min(len(dst), numBands).
+//
+// If the spectrum analysis is disabled, it returns 0.
+// See EnableSpectrum.
+//
+// This method can be called from any goroutine.
+func (s *Stream) SpectrumBands(dst []float32) int {
+	sp := s.settings.spectrum
+	if sp == nil {
+		return 0
+	}
+	sp.mu.Lock()
+	n := copy(dst, sp.published)
+	sp.mu.Unlock()
+	return n
+}
+
+func newStreamSpectrum(numBands int) *streamSpectrum {
+	sp := &streamSpectrum{
+		fft:       newFFT(spectrumSize),
+		window:    make([]float64, spectrumSize),
+		history:   make([]float64, spectrumSize),
+		re:        make([]float64, spectrumSize),
+		im:        make([]float64, spectrumSize),
+		bandEdges: make([]int, numBands+1),
+		bands:     make([]float32, numBands),
+		published: make([]float32, numBands),
+	}
+
+	for i := range sp.window {
+		sp.window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(spectrumSize-1))
+	}
+
+	// The bins are spread logarithmically between the bin 1 and the Nyquist frequency.
+	// Every band gets at least one bin, so the low bands may be wider than needed.
+	// The bin 0 (DC offset) is not used.
+	numBins := spectrumSize / 2
+	sp.bandEdges[0] = 1
+	for i := 1; i <= numBands; i++ {
+		edge := int(math.Round(math.Pow(float64(numBins), float64(i)/float64(numBands))))
+		edge = max(edge, sp.bandEdges[i-1]+1)
+		sp.bandEdges[i] = min(edge, numBins)
+	}
+
+	return sp
+}
+
+func (sp *streamSpectrum) analyze(pcm []byte) {
+	// Append the new samples to the history.
+	for i := 0; i+4 <= len(pcm); i += 4 {
+		left := int16(binary.LittleEndian.Uint16(pcm[i:]))
+		right := int16(binary.LittleEndian.Uint16(pcm[i+2:]))
+		sp.history[sp.historyPos] = (float64(left) + float64(right)) / (2 * 32768)
+		sp.historyPos = (sp.historyPos + 1) % spectrumSize
+	}
+
+	// historyPos points to the oldest sample.
+	for i := range sp.re {
+		sp.re[i] = sp.history[(sp.historyPos+i)%spectrumSize] * sp.window[i]
+		sp.im[i] = 0
+	}
+	sp.fft.transform(sp.re, sp.im)
+
+	// A full-scale sine wave has a magnitude of N/4 with the Hann window.
+	// The band value is the total energy of its bins, so a sine wave
+	// that falls into a single band gives a value close to its amplitude.
+	const scale = 4.0 / spectrumSize
+	for b := range sp.bands {
+		from := sp.bandEdges[b]
+		to := sp.bandEdges[b+1]
+		power := 0.0
+		for k := from; k < to; k++ {
+			power += sp.re[k]*sp.re[k] + sp.im[k]*sp.im[k]
+		}
+		sp.bands[b] = float32(math.Sqrt(power) * scale)
+	}
+
+	sp.mu.Lock()
+	copy(sp.published, sp.bands)
+	sp.mu.Unlock()
+}
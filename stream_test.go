@@ -0,0 +1,331 @@
+package xm
+
+import (
+	"io"
+	"math"
+	"testing"
+
+	"github.com/quasilyte/xm/xmfile"
+)
+
+// testEffect places an effect into the second channel of the test module.
+type testEffect struct {
+	pattern int
+	row     int
+	op      uint8
+	arg     uint8
+}
+
+// newTestModule creates a 2-channel module with 2 patterns of 16 rows.
+// The pattern order is [0, 1, 0]; the default tempo is 6 and the BPM is 125,
+// so every tick is exactly 882 frames long (at 44100 sample rate).
+//
+// The first channel plays a note every 4 rows.
+// The second channel contains only the specified effects.
+func newTestModule(effects ...testEffect) *xmfile.Module {
+	m := &xmfile.Module{
+		Name:           "test",
+		NumChannels:    2,
+		NumPatterns:    2,
+		NumInstruments: 1,
+		Flags:          1,
+		DefaultTempo:   6,
+		DefaultBPM:     125,
+		SongLength:     3,
+		PatternOrder:   []uint8{0, 1, 0},
+	}
+
+	// A looped square wave sample, encoded as 8-bit deltas.
+	data := make([]byte, 64)
+	prev := int8(0)
+	for i := range data {
+		v := int8(60)
+		if (i/8)%2 == 0 {
+			v = -60
+		}
+		data[i] = byte(v - prev)
+		prev = v
+	}
+	m.Instruments = []xmfile.Instrument{{
+		Samples: []xmfile.InstrumentSample{{
+			Length:     64,
+			LoopLength: 64,
+			Volume:     64,
+			Panning:    128,
+			TypeFlags:  1,
+			Data:       data,
+		}},
+	}}
+
+	m.Notes = []xmfile.PatternNote{{}}
+	noteID := func(n xmfile.PatternNote) uint16 {
+		if n == (xmfile.PatternNote{}) {
+			return 0
+		}
+		n.ID = uint16(len(m.Notes))
+		m.Notes = append(m.Notes, n)
+		return n.ID
+	}
+	for p := 0; p < m.NumPatterns; p++ {
+		var pat xmfile.Pattern
+		for r := 0; r < 16; r++ {
+			var row xmfile.PatternRow
+			var n xmfile.PatternNote
+			if r%4 == 0 {
+				n.Note = uint8(49 + r/4 + p*5)
+				n.Instrument = 1
+			}
+			row.Notes = append(row.Notes, noteID(n))
+			n = xmfile.PatternNote{}
+			for _, e := range effects {
+				if e.pattern == p && e.row == r {
+					n.EffectType = e.op
+					n.EffectParameter = e.arg
+				}
+			}
+			row.Notes = append(row.Notes, noteID(n))
+			pat.Rows = append(pat.Rows, row)
+		}
+		m.Patterns = append(m.Patterns, pat)
+	}
+
+	return m
+}
+
+func newTestStream(t *testing.T, effects ...testEffect) *Stream {
+	t.Helper()
+	s := NewStream()
+	if err := s.LoadModule(newTestModule(effects...), LoadModuleConfig{}); err != nil {
+		t.Fatalf("load module: %v", err)
+	}
+	return s
+}
+
+func TestStreamTempoNoteEvents(t *testing.T) {
+	// F03 sets the tempo to 3 ticks per row starting from the row 4 of the pattern 0.
+	// The pattern 0 is played twice: the second time it keeps the tempo of 3.
+	xmModule := newTestModule(testEffect{pattern: 0, row: 4, op: 0x0F, arg: 0x03})
+	compiled, err := Compile(xmModule, LoadModuleConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every tick is 0.02 seconds long (BPM=125).
+	var want []float64
+	{
+		tempo := 6
+		rowTime := 0.0
+		for _, p := range xmModule.PatternOrder {
+			for row := 0; row < 16; row++ {
+				if p == 0 && row == 4 {
+					tempo = 3
+				}
+				if row%4 == 0 {
+					want = append(want, rowTime)
+				}
+				rowTime += float64(tempo) * 0.02
+			}
+		}
+	}
+
+	playSong := func(stage string, s *Stream) {
+		t.Helper()
+		var times []float64
+		s.SetEventHandler(func(e StreamEvent) {
+			if e.Kind == EventNote && e.Channel == 0 {
+				times = append(times, e.Time)
+			}
+		})
+		if _, err := io.Copy(io.Discard, s); err != nil {
+			t.Fatalf("%s: read: %v", stage, err)
+		}
+		if len(times) != len(want) {
+			t.Fatalf("%s: got %d note events, want %d", stage, len(times), len(want))
+		}
+		for i := range times {
+			if math.Abs(times[i]-want[i]) > 1e-9 {
+				t.Fatalf("%s: note event %d time mismatch:\nhave %f\nwant %f", stage, i, times[i], want[i])
+			}
+		}
+	}
+
+	s := NewStream()
+	s.SetModule(compiled)
+	playSong("initial", s)
+
+	// The tempo must be reset to the module default by the rewind.
+	s.Rewind()
+	playSong("after rewind", s)
+
+	// The tempo changes of one stream should not affect other streams.
+	s2 := NewStream()
+	s2.SetModule(compiled)
+	playSong("another stream", s2)
+}
+
+func readFrames(t *testing.T, s *Stream, numFrames int) {
+	t.Helper()
+	buf := make([]byte, numFrames*4)
+	if _, err := io.ReadFull(s, buf); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+}
+
+func TestStreamTempoRewind(t *testing.T) {
+	// F03 sets the tempo to 3 ticks per row starting from the row 4.
+	s := newTestStream(t, testEffect{pattern: 0, row: 4, op: 0x0F, arg: 0x03})
+
+	type rowInfo struct {
+		row    int
+		time   float64
+		offset int64
+	}
+	var rows []rowInfo
+	s.SetEventHandler(func(e StreamEvent) {
+		if e.Kind != EventRow {
+			return
+		}
+		_, _, row := e.RowEventData()
+		rows = append(rows, rowInfo{row: row, time: e.Time, offset: e.SampleOffset})
+	})
+
+	const tickFrames = 882
+	const tickSeconds = 0.02
+	want := []rowInfo{
+		{row: 0, time: 0, offset: 0},
+		{row: 1, time: 6 * tickSeconds, offset: 6 * tickFrames},
+		{row: 2, time: 12 * tickSeconds, offset: 12 * tickFrames},
+		{row: 3, time: 18 * tickSeconds, offset: 18 * tickFrames},
+		{row: 4, time: 24 * tickSeconds, offset: 24 * tickFrames},
+		{row: 5, time: 27 * tickSeconds, offset: 27 * tickFrames},
+		{row: 6, time: 30 * tickSeconds, offset: 30 * tickFrames},
+	}
+	check := func(stage string) {
+		t.Helper()
+		if len(rows) != len(want) {
+			t.Fatalf("%s: got %d row events, want %d", stage, len(rows), len(want))
+		}
+		for i, r := range rows {
+			w := want[i]
+			if r.row != w.row || math.Abs(r.time-w.time) > 1e-9 || r.offset != w.offset {
+				t.Fatalf("%s: row event %d:\nhave %+v\nwant %+v", stage, i, r, w)
+			}
+		}
+	}
+
+	// Read the row 6 first tick to get its event.
+	readFrames(t, s, 31*tickFrames)
+	check("initial")
+
+	// The tempo must be reset to the module default by the rewind.
+	rows = rows[:0]
+	s.Rewind()
+	readFrames(t, s, 31*tickFrames)
+	check("after rewind")
+}
+
+func TestStreamWriteToLooping(t *testing.T) {
+	// 3 orders of 16 rows, 6 ticks per row.
+	const songBytes = 3 * 16 * 6 * 882 * 4
+
+	tests := []struct {
+		name      string
+		configure func(s *Stream)
+		want      int64 // -1 means "an error is expected"
+	}{
+		{
+			name:      "no looping",
+			configure: func(s *Stream) {},
+			want:      songBytes,
+		},
+		{
+			name: "infinite song loop",
+			configure: func(s *Stream) {
+				s.SetLooping(true)
+			},
+			want: -1,
+		},
+		{
+			name: "finite song loop",
+			configure: func(s *Stream) {
+				s.SetLooping(true)
+				s.SetLoopCount(2)
+			},
+			want: 3 * songBytes,
+		},
+		{
+			name: "infinite song loop with max duration",
+			configure: func(s *Stream) {
+				s.SetLooping(true)
+				s.SetMaxDuration(1)
+			},
+			want: 44100 * 4,
+		},
+		{
+			name: "infinite loop range",
+			configure: func(s *Stream) {
+				_ = s.SetLoopRange(1, 0, 1, 15)
+			},
+			want: -1,
+		},
+		{
+			name: "finite loop range",
+			configure: func(s *Stream) {
+				_ = s.SetLoopRange(1, 0, 1, 15)
+				s.SetLoopCount(1)
+			},
+			want: songBytes + songBytes/3,
+		},
+		{
+			name: "finite loop range with song loop",
+			configure: func(s *Stream) {
+				_ = s.SetLoopRange(1, 0, 1, 15)
+				s.SetLoopCount(1)
+				s.SetLooping(true)
+			},
+			want: -1,
+		},
+		{
+			name: "infinite song loop with fade out",
+			configure: func(s *Stream) {
+				s.SetLooping(true)
+				s.FadeOut(0.5)
+			},
+			want: 25 * 882 * 4,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newTestStream(t)
+			test.configure(s)
+			n, err := s.WriteTo(io.Discard)
+			if test.want == -1 {
+				if err == nil {
+					t.Fatalf("expected an error, got %d bytes written", n)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if n != test.want {
+				t.Fatalf("written bytes mismatch:\nhave %d\nwant %d", n, test.want)
+			}
+		})
+	}
+}
+
+func TestStreamControlsOutOfBounds(t *testing.T) {
+	// Invalid indexes are ignored, the same way the controller does it.
+	s := newTestStream(t)
+	for _, i := range []int{-1, 2} {
+		s.SetChannelVolume(i, 0.5)
+		s.SetChannelMuted(i, true)
+		s.SetChannelSolo(i, true)
+		s.SetInstrumentVolume(i, 0.5)
+	}
+	if s.settings.numSolo != 0 {
+		t.Fatalf("numSolo is %d after out of bounds calls", s.settings.numSolo)
+	}
+}
@@ -49,8 +49,7 @@ type SynthesizerConfig struct {
 
 func NewSynthesizer(config SynthesizerConfig) *Synthesizer {
 	stream := NewStream()
-	stream.channels = make([]streamChannel, config.NumChannels)
-	stream.activeChannels = make([]*streamChannel, config.NumChannels)
+	stream.setNumChannels(config.NumChannels)
 	return &Synthesizer{
 		stream:       stream,
 		noteCompiler: newSynthCompiler(),
@@ -68,8 +67,11 @@ func (s *Synthesizer) SetInstruments(is *SynthesizerInstruments) error {
 		return errors.New("mismatching channel count")
 	}
 
+	// Every synthesizer needs its own module copy as
+	// it modifies the notes and effects for every PlayNote call.
+	instOnly := is.instOnly
 	s.stream.activeChannels = s.stream.activeChannels[:0]
-	s.stream.assignCompiledModule(is.instOnly)
+	s.stream.assignCompiledModule(&instOnly)
 
 	return nil
 }
@@ -82,7 +84,7 @@ func (s *Synthesizer) SetInstruments(is *SynthesizerInstruments) error {
 // The instruments are only compatible if the number of channels is matching.
 func (s *Synthesizer) GetInstruments() *SynthesizerInstruments {
 	return &SynthesizerInstruments{
-		instOnly:    s.stream.module,
+		instOnly:    *s.stream.module,
 		numChannels: len(s.stream.channels),
 	}
 }
@@ -98,7 +100,7 @@ func (s *Synthesizer) GetInstruments() *SynthesizerInstruments {
 // The patterns don't really matter as this method
 // is only interested in instruments (and samples).
 func (s *Synthesizer) LoadInstruments(m *xmfile.Module, config LoadModuleConfig) error {
-	s.stream.applyConfigDefaults(m, &config)
+	applyConfigDefaults(m, &config)
 
 	s.stream.activeChannels = s.stream.activeChannels[:0]
 
@@ -107,7 +109,7 @@ func (s *Synthesizer) LoadInstruments(m *xmfile.Module, config LoadModuleConfig)
 		return err
 	}
 
-	s.stream.assignCompiledModule(instOnly)
+	s.stream.assignCompiledModule(&instOnly)
 
 	return nil
 }
@@ -122,10 +124,10 @@ func (s *Synthesizer) compileModuleInstruments(m *xmfile.Module, config LoadModu
 	}
 
 	compiled, err := compileModule(&instOnly, moduleConfig{
-		sampleRate: config.SampleRate,
-		bpm:        config.BPM,
-		tempo:      config.Tempo,
-		subSamples: config.LinearInterpolation,
+		sampleRate:    config.SampleRate,
+		bpm:           config.BPM,
+		tempo:         config.Tempo,
+		interpolation: config.Interpolation,
 	})
 	if err != nil {
 		return compiled, err
@@ -151,16 +153,19 @@ func (s *Synthesizer) compileModuleInstruments(m *xmfile.Module, config LoadModu
 }
 
 func (s *Synthesizer) prepareToPlay(duration float64) {
-	s.noteCompiler.reset(&s.stream.module)
+	s.noteCompiler.reset(s.stream.module)
 
 	s.stream.module.effectTab = s.stream.module.effectTab[:0]
 	s.stream.module.noteTab = s.stream.module.noteTab[:0]
 
-	if duration == 0 {
-		s.stream.setTempo(240)
-	} else {
-		s.stream.setTempo(1 + int(ticksPerSecond(s.stream.bpm)*duration))
+	tempo := 240
+	if duration != 0 {
+		tempo = 1 + int(ticksPerSecond(s.stream.bpm)*duration)
 	}
+	// Synthesizer owns its module, so it can change the default tempo.
+	// This way the tempo is preserved after the stream rewind.
+	s.stream.module.ticksPerRow = tempo
+	s.stream.setTempo(tempo)
 }
 
 // PlayNote plays one or more notes up to the specified duration.
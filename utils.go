@@ -5,7 +5,7 @@ import (
 )
 
 type numeric interface {
-	uint8 | int | float64
+	uint8 | int | float32 | float64
 }
 
 func slideTowards[T numeric](v, goal, delta T) T {
@@ -0,0 +1,136 @@
+// Package wav implements a RIFF WAV encoding for the XM streams.
+//
+// It's intended to be used for the offline rendering:
+// for instance, to pre-render music for the platforms
+// that can't afford the realtime mixing.
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+
+	"github.com/quasilyte/xm"
+)
+
+const (
+	headerSize = 44
+
+	numChannels   = 2
+	bitsPerSample = 16
+	bytesPerFrame = numChannels * bitsPerSample / 8
+)
+
+// Write renders the entire stream into w as a RIFF WAV file.
+//
+// The stream must have a finite length.
+// If the stream loops infinitely, use Stream.SetMaxDuration to limit it.
+//
+// See Encode for the details.
+func Write(w io.Writer, s *xm.Stream) (int64, error) {
+	info := s.GetInfo()
+	return Encode(w, s, int(info.SampleRate))
+}
+
+// Encode reads the 16-bit stereo LE PCM data from r until EOF
+// and writes it into w as a RIFF WAV file.
+//
+// WAV header needs to know the data size in advance.
+// If w implements io.WriteSeeker (like os.File does), the header is
+// updated after the PCM data is written.
+// Otherwise the PCM data is buffered in memory first.
+func Encode(w io.Writer, r io.Reader, sampleRate int) (int64, error) {
+	if sampleRate <= 0 {
+		return 0, errors.New("invalid sample rate")
+	}
+
+	if ws, ok := w.(io.WriteSeeker); ok {
+		if start, err := ws.Seek(0, io.SeekCurrent); err == nil {
+			return encodeSeekable(ws, start, r, sampleRate)
+		}
+	}
+
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, r); err != nil {
+		return 0, err
+	}
+	if err := checkDataSize(int64(buf.Len())); err != nil {
+		return 0, err
+	}
+	header := makeHeader(sampleRate, buf.Len())
+	n, err := w.Write(header[:])
+	total := int64(n)
+	if err != nil {
+		return total, err
+	}
+	dataWritten, err := buf.WriteTo(w)
+	total += dataWritten
+	return total, err
+}
+
+func encodeSeekable(w io.WriteSeeker, start int64, r io.Reader, sampleRate int) (int64, error) {
+	// Write a placeholder header first; it will be overwritten later.
+	header := makeHeader(sampleRate, 0)
+	n, err := w.Write(header[:])
+	total := int64(n)
+	if err != nil {
+		return total, err
+	}
+
+	dataSize, err := io.Copy(w, r)
+	total += dataSize
+	if err != nil {
+		return total, err
+	}
+	if err := checkDataSize(dataSize); err != nil {
+		return total, err
+	}
+
+	header = makeHeader(sampleRate, int(dataSize))
+	if _, err := w.Seek(start, io.SeekStart); err != nil {
+		return total, err
+	}
+	if _, err := w.Write(header[:]); err != nil {
+		return total, err
+	}
+	if _, err := w.Seek(start+total, io.SeekStart); err != nil {
+		return total, err
+	}
+
+	return total, nil
+}
+
+func checkDataSize(size int64) error {
+	if size%bytesPerFrame != 0 {
+		return errors.New("PCM data size is not aligned to the frame size")
+	}
+	if size > math.MaxUint32-headerSize {
+		return errors.New("PCM data is too big for a WAV file")
+	}
+	return nil
+}
+
+func makeHeader(sampleRate, dataSize int) [headerSize]byte {
+	var header [headerSize]byte
+	le := binary.LittleEndian
+
+	copy(header[0:], "RIFF")
+	le.PutUint32(header[4:], uint32(headerSize-8+dataSize))
+	copy(header[8:], "WAVE")
+
+	copy(header[12:], "fmt ")
+	le.PutUint32(header[16:], 16) // The fmt chunk size
+	le.PutUint16(header[20:], 1)  // PCM format
+	le.PutUint16(header[22:], numChannels)
+	le.PutUint32(header[24:], uint32(sampleRate))
+	le.PutUint32(header[28:], uint32(sampleRate*bytesPerFrame))
+	le.PutUint16(header[32:], bytesPerFrame)
+	le.PutUint16(header[34:], bitsPerSample)
+
+	copy(header[36:], "data")
+	le.PutUint32(header[40:], uint32(dataSize))
+
+	return header
+}
@@ -15,6 +15,25 @@ func moduleSize(m *module) uint {
 	}
 	memoryUsage += len(m.noteTab) * int(unsafe.Sizeof(patternNote{}))
 	memoryUsage += len(m.effectTab) * int(unsafe.Sizeof(noteEffect{}))
+	if m.interpolation == InterpolationSinc {
+		// The sinc table is shared between all modules,
+		// but it's allocated only if sinc interpolation is used.
+		memoryUsage += int(unsafe.Sizeof(sincTable))
+	}
 
 	return uint(memoryUsage)
 }
+
+// instrumentIndex returns the inst index inside m.instruments.
+// inst must point to the m.instruments element.
+func instrumentIndex(m *module, inst *instrument) int {
+	base := unsafe.Pointer(unsafe.SliceData(m.instruments))
+	return int((uintptr(unsafe.Pointer(inst)) - uintptr(base)) / unsafe.Sizeof(instrument{}))
+}
+
+// noteIndex returns the n index inside m.noteTab.
+// n must point to the m.noteTab element.
+func noteIndex(m *module, n *patternNote) int {
+	base := unsafe.Pointer(unsafe.SliceData(m.noteTab))
+	return int((uintptr(unsafe.Pointer(n)) - uintptr(base)) / unsafe.Sizeof(patternNote{}))
+}